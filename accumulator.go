@@ -0,0 +1,131 @@
+package deepseek
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// StreamAccumulator rebuilds a completion from the chunks of a streaming completion.
+//
+// Usage is only reported by the API when StreamOptions.IncludeUsage is set.
+type StreamAccumulator struct {
+	response CompletionResponse
+	choices  map[int64]*accumulatedChoice
+	usage    *CompletionUsage
+}
+
+type accumulatedChoice struct {
+	role         Role
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    []CompletionToolCall
+	finishReason CompletionFinishReason
+}
+
+// Add accumulates a chunk.
+func (a *StreamAccumulator) Add(chunk StreamCompletionChunk) {
+	if a.choices == nil {
+		a.choices = map[int64]*accumulatedChoice{}
+	}
+
+	a.response.ID = chunk.ID
+	a.response.Model = chunk.Model
+	a.response.Created = chunk.Created
+	a.response.SystemFingerprint = chunk.SystemFingerprint
+	a.response.Object = "chat.completion"
+
+	for _, c := range chunk.Choices {
+		choice, ok := a.choices[c.Index]
+		if !ok {
+			choice = &accumulatedChoice{}
+			a.choices[c.Index] = choice
+		}
+		if c.Delta.Role != "" {
+			choice.role = c.Delta.Role
+		}
+		choice.content.WriteString(c.Delta.Content)
+		choice.reasoning.WriteString(c.Delta.ReasoningContent)
+		for _, call := range c.Delta.ToolCalls {
+			choice.addToolCall(call)
+		}
+		if c.FinishReason != "" {
+			choice.finishReason = c.FinishReason
+		}
+	}
+
+	if chunk.Usage != nil {
+		usage := *chunk.Usage
+		a.usage = &usage
+	}
+}
+
+// Response returns the completion accumulated so far.
+func (a *StreamAccumulator) Response() CompletionResponse {
+	response := a.response
+	response.Choices = make([]CompletionChoice, 0, len(a.choices))
+	for index, choice := range a.choices {
+		role := choice.role
+		if role == "" {
+			role = AssistantRole
+		}
+		response.Choices = append(response.Choices, CompletionChoice{
+			Index:        index,
+			Message:      Message{Role: role, Content: choice.content.String(), ToolCalls: choice.toolCalls},
+			FinishReason: choice.finishReason,
+		})
+	}
+	sort.Slice(response.Choices, func(i, j int) bool {
+		return response.Choices[i].Index < response.Choices[j].Index
+	})
+	if a.usage != nil {
+		response.Usage = *a.usage
+	}
+	return response
+}
+
+// addToolCall merges a tool call fragment into the tool call sharing its index.
+func (c *accumulatedChoice) addToolCall(fragment StreamToolCall) {
+	for int64(len(c.toolCalls)) <= fragment.Index {
+		c.toolCalls = append(c.toolCalls, CompletionToolCall{})
+	}
+	call := &c.toolCalls[fragment.Index]
+	if fragment.ID != "" {
+		call.ID = fragment.ID
+	}
+	if fragment.Type != "" {
+		call.Type = fragment.Type
+	}
+	call.Function.Name += fragment.Function.Name
+	call.Function.Arguments += fragment.Function.Arguments
+}
+
+// ReasoningContent returns the reasoning content accumulated for the choice at the given index.
+func (a *StreamAccumulator) ReasoningContent(index int64) string {
+	if choice, ok := a.choices[index]; ok {
+		return choice.reasoning.String()
+	}
+	return ""
+}
+
+// Usage returns the usage reported by the last chunk, if any.
+func (a *StreamAccumulator) Usage() (CompletionUsage, bool) {
+	if a.usage == nil {
+		return CompletionUsage{}, false
+	}
+	return *a.usage, true
+}
+
+// Cost computes the cost of the reported usage using DefaultPrices.
+func (a *StreamAccumulator) Cost() Amount {
+	usage, _ := a.Usage()
+	return Cost(usage, a.response.Model, createdAt(a.response.Created))
+}
+
+// createdAt converts the creation timestamp of a response, defaulting to now when it is missing.
+func createdAt(created int64) time.Time {
+	if created == 0 {
+		return time.Now()
+	}
+	return time.Unix(created, 0)
+}
@@ -0,0 +1,219 @@
+package deepseek
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrLowBalance is returned by a blocking BalanceGuard when the account can't pay for new completions.
+type ErrLowBalance struct {
+	// Unavailable indicates that the API reported the balance as not available.
+	Unavailable bool
+
+	// Currency is the currency whose balance fell below its floor.
+	Currency string
+
+	// Balance is the total balance of Currency.
+	Balance Decimal
+
+	// Floor is the configured floor of Currency.
+	Floor Decimal
+}
+
+func (e *ErrLowBalance) Error() string {
+	if e.Unavailable {
+		return "low balance: balance is not available"
+	}
+	return fmt.Sprintf("low balance: %s %s is below the floor of %s", e.Balance, e.Currency, e.Floor)
+}
+
+// BalanceThreshold triggers a callback when the balance of a currency falls below an amount.
+type BalanceThreshold struct {
+	// Currency is the currency of Amount, e.g. "USD" or "CNY".
+	Currency string
+
+	// Amount is the threshold of the total balance.
+	Amount Decimal
+
+	// OnCross is called when the total balance falls below Amount. It is called again only after the balance went back above Amount.
+	OnCross func(summary BalanceSummary)
+}
+
+type BalanceGuardConfig struct {
+	// Interval is the polling interval of the balance. Defaults to 5 minutes.
+	Interval time.Duration
+
+	// Thresholds are the balance thresholds to watch.
+	Thresholds []BalanceThreshold
+
+	// Block makes the guard reject new completions with ErrLowBalance when the balance isn't available or falls below a floor.
+	Block bool
+
+	// Floors are the minimum total balances by currency under which completions are blocked.
+	Floors map[string]Decimal
+
+	// OnError is called when polling the balance fails.
+	OnError func(err error)
+
+	// Clock defaults to SystemClock.
+	Clock Clock
+}
+
+// BalanceGuard polls the user balance in the background to warn about and optionally block completions on low balance.
+//
+// The guard doesn't block anything until the balance has been fetched at least once.
+type BalanceGuard struct {
+	balances BalanceGetter
+	config   BalanceGuardConfig
+
+	mu        sync.RWMutex
+	balance   *UserBalanceResponse
+	summaries map[string]BalanceSummary
+	updatedAt time.Time
+	crossed   map[int]bool
+
+	// stop stops the polling started by Start.
+	stop func()
+}
+
+// NewBalanceGuard creates a balance guard. Call Start or Run to start polling.
+func NewBalanceGuard(balances BalanceGetter, config BalanceGuardConfig) *BalanceGuard {
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+	return &BalanceGuard{
+		balances: balances,
+		config:   config,
+		crossed:  map[int]bool{},
+	}
+}
+
+// Start polls the balance in the background until Close is called. It does nothing if the guard was already started.
+func (g *BalanceGuard) Start() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stop != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Run(ctx)
+	}()
+	g.stop = func() {
+		cancel()
+		<-done
+	}
+}
+
+// Close stops the polling started by Start and waits for it to return.
+func (g *BalanceGuard) Close() error {
+	g.mu.Lock()
+	stop := g.stop
+	g.stop = nil
+	g.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	return nil
+}
+
+// Run polls the balance until ctx is done.
+func (g *BalanceGuard) Run(ctx context.Context) {
+	for {
+		if err := g.Refresh(); err != nil && g.config.OnError != nil {
+			g.config.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.config.Clock.After(g.config.Interval):
+		}
+	}
+}
+
+// Refresh fetches the balance once and triggers the crossed thresholds.
+func (g *BalanceGuard) Refresh() error {
+	balance, err := g.balances.GetUserBalance()
+	if err != nil {
+		return err
+	}
+	return g.Update(balance)
+}
+
+// Update records a balance fetched elsewhere and triggers the crossed thresholds.
+func (g *BalanceGuard) Update(balance *UserBalanceResponse) error {
+	summaries, err := balance.Summaries()
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	g.balance = balance
+	g.summaries = summaries
+	g.updatedAt = g.config.Clock.Now()
+
+	var triggered []func()
+	for i, threshold := range g.config.Thresholds {
+		summary, ok := summaries[threshold.Currency]
+		if !ok {
+			continue
+		}
+		below := summary.Total.Cmp(threshold.Amount) < 0
+		if below && !g.crossed[i] && threshold.OnCross != nil {
+			onCross := threshold.OnCross
+			triggered = append(triggered, func() { onCross(summary) })
+		}
+		g.crossed[i] = below
+	}
+	g.mu.Unlock()
+
+	// Callbacks are called without holding the lock so they can use the guard.
+	for _, fn := range triggered {
+		fn()
+	}
+	return nil
+}
+
+// Balance returns the last fetched balance and when it was fetched, or nil if it has never been fetched.
+func (g *BalanceGuard) Balance() (*UserBalanceResponse, time.Time) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.balance, g.updatedAt
+}
+
+// Check returns ErrLowBalance if the guard blocks completions.
+func (g *BalanceGuard) Check() error {
+	if !g.config.Block {
+		return nil
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.balance == nil {
+		return nil
+	}
+	if !g.balance.IsAvailable {
+		return &ErrLowBalance{Unavailable: true}
+	}
+	for currency, floor := range g.config.Floors {
+		summary, ok := g.summaries[currency]
+		if ok && summary.Total.Cmp(floor) < 0 {
+			return &ErrLowBalance{Currency: currency, Balance: summary.Total, Floor: floor}
+		}
+	}
+	return nil
+}
+
+// Middleware returns a middleware rejecting completions with ErrLowBalance when the guard blocks them.
+func (g *BalanceGuard) Middleware() ChatMiddleware {
+	return checkMiddleware(func(context.Context, ModelID) error {
+		return g.Check()
+	})
+}
@@ -0,0 +1,263 @@
+package deepseek
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNotEnoughSnapshots = errors.New("not enough balance snapshots")
+
+// BalanceSnapshot is the balance of the account at a point in time.
+type BalanceSnapshot struct {
+	Time        time.Time        `json:"time"`
+	IsAvailable bool             `json:"is_available"`
+	Balances    []BalanceSummary `json:"balances"`
+}
+
+// Balance returns the balance of a currency in the snapshot.
+func (s BalanceSnapshot) Balance(currency string) (BalanceSummary, bool) {
+	for _, balance := range s.Balances {
+		if balance.Currency == currency {
+			return balance, true
+		}
+	}
+	return BalanceSummary{}, false
+}
+
+// BalanceHistory stores balance snapshots in an append-only JSONL file to compute the spend rate of the account.
+type BalanceHistory struct {
+	mu   sync.Mutex
+	path string
+
+	// OnError is called by Run when a snapshot fails.
+	OnError func(err error)
+}
+
+// NewBalanceHistory creates a balance history stored in the file at path. The file is created on the first snapshot.
+func NewBalanceHistory(path string) *BalanceHistory {
+	return &BalanceHistory{path: path}
+}
+
+// Run takes a snapshot of the balance every interval until ctx is done.
+func (h *BalanceHistory) Run(ctx context.Context, balances BalanceGetter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := h.Snapshot(balances); err != nil && h.OnError != nil {
+			h.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Snapshot fetches the balance and appends it to the history.
+func (h *BalanceHistory) Snapshot(balances BalanceGetter) (BalanceSnapshot, error) {
+	balance, err := balances.GetUserBalance()
+	if err != nil {
+		return BalanceSnapshot{}, err
+	}
+	return h.Record(balance, time.Now())
+}
+
+// Record appends a balance fetched at the given time to the history.
+func (h *BalanceHistory) Record(balance *UserBalanceResponse, at time.Time) (BalanceSnapshot, error) {
+	summaries, err := balance.Summaries()
+	if err != nil {
+		return BalanceSnapshot{}, err
+	}
+
+	snapshot := BalanceSnapshot{Time: at, IsAvailable: balance.IsAvailable}
+	for _, info := range balance.BalanceInfos {
+		if _, ok := snapshot.Balance(info.Currency); !ok {
+			snapshot.Balances = append(snapshot.Balances, summaries[info.Currency])
+		}
+	}
+
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return BalanceSnapshot{}, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return BalanceSnapshot{}, err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return BalanceSnapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// Snapshots returns the snapshots taken in the [since, until) window, in the order they were taken. A zero time leaves the window open on that side.
+func (h *BalanceHistory) Snapshots(since, until time.Time) ([]BalanceSnapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	file, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var snapshots []BalanceSnapshot
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var snapshot BalanceSnapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			return nil, err
+		}
+		if inWindow(snapshot.Time, since, until) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, scanner.Err()
+}
+
+// BurnRate is the spend of a currency over a time window.
+type BurnRate struct {
+	Currency string `json:"currency"`
+
+	// Since and Until are the times of the first and last snapshots of the window.
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+
+	// Spent is the total spend, the sum of SpentGranted and SpentToppedUp.
+	Spent Decimal `json:"spent"`
+
+	// SpentGranted is the spend of the granted balance.
+	SpentGranted Decimal `json:"spent_granted"`
+
+	// SpentToppedUp is the spend of the topped-up balance.
+	SpentToppedUp Decimal `json:"spent_topped_up"`
+
+	// ToppedUp is the amount added to the balance during the window.
+	ToppedUp Decimal `json:"topped_up"`
+
+	// PerHour is the average spend per hour.
+	PerHour float64 `json:"per_hour"`
+}
+
+// BurnRate computes the spend of a currency over the window ending at now.
+//
+// Spend is measured as the decrease of the granted and topped-up balances between consecutive snapshots, so spend happening
+// between two snapshots surrounding a top-up is partially hidden by it.
+func (h *BalanceHistory) BurnRate(currency string, window time.Duration, now time.Time) (BurnRate, error) {
+	rate, _, err := h.burnRate(currency, window, now)
+	return rate, err
+}
+
+// burnRate computes the burn rate and returns the latest balance of the window along with it.
+func (h *BalanceHistory) burnRate(currency string, window time.Duration, now time.Time) (BurnRate, BalanceSummary, error) {
+	snapshots, err := h.Snapshots(now.Add(-window), now.Add(time.Nanosecond))
+	if err != nil {
+		return BurnRate{}, BalanceSummary{}, err
+	}
+
+	rate := BurnRate{Currency: currency}
+	var previous *BalanceSummary
+	for _, snapshot := range snapshots {
+		balance, ok := snapshot.Balance(currency)
+		if !ok {
+			continue
+		}
+		if previous == nil {
+			rate.Since = snapshot.Time
+		} else {
+			if granted := previous.Granted.Sub(balance.Granted); granted.Sign() > 0 {
+				rate.SpentGranted = rate.SpentGranted.Add(granted)
+			}
+			switch toppedUp := previous.ToppedUp.Sub(balance.ToppedUp); toppedUp.Sign() {
+			case 1:
+				rate.SpentToppedUp = rate.SpentToppedUp.Add(toppedUp)
+			case -1:
+				rate.ToppedUp = rate.ToppedUp.Sub(toppedUp)
+			}
+		}
+		rate.Until = snapshot.Time
+		previous = &balance
+	}
+
+	if previous == nil || !rate.Until.After(rate.Since) {
+		return rate, BalanceSummary{}, ErrNotEnoughSnapshots
+	}
+	rate.Spent = rate.SpentGranted.Add(rate.SpentToppedUp)
+	rate.PerHour = rate.Spent.Float64() / rate.Until.Sub(rate.Since).Hours()
+	return rate, *previous, nil
+}
+
+// BalanceForecast projects when the balance of a currency runs out at the current burn rate.
+type BalanceForecast struct {
+	BurnRate
+
+	// Balance is the latest total balance.
+	Balance Decimal `json:"balance"`
+
+	// DepletesAt is when the balance is projected to run out. It is zero when nothing is being spent.
+	DepletesAt time.Time `json:"depletes_at"`
+}
+
+// Forecast projects the depletion of the balance of a currency from its burn rate over the window ending at now.
+func (h *BalanceHistory) Forecast(currency string, window time.Duration, now time.Time) (BalanceForecast, error) {
+	rate, balance, err := h.burnRate(currency, window, now)
+	if err != nil {
+		return BalanceForecast{}, err
+	}
+
+	forecast := BalanceForecast{BurnRate: rate, Balance: balance.Total}
+	if rate.PerHour > 0 {
+		hours := balance.Total.Float64() / rate.PerHour
+		forecast.DepletesAt = rate.Until.Add(time.Duration(hours * float64(time.Hour)))
+	}
+	return forecast, nil
+}
+
+// BalanceCrossCheck compares the spend measured from balance snapshots with the cost recorded by a ledger.
+type BalanceCrossCheck struct {
+	BurnRate
+
+	// LedgerCost is the cost recorded by the ledger over the same window.
+	LedgerCost float64 `json:"ledger_cost"`
+
+	// Difference is the balance spend minus the ledger cost. A positive difference is spend the ledger didn't see,
+	// e.g. from other clients sharing the account.
+	Difference float64 `json:"difference"`
+}
+
+// CrossCheck compares the spend of a currency over the window ending at now with the cost recorded by the ledger.
+func (h *BalanceHistory) CrossCheck(ledger *Ledger, currency string, window time.Duration, now time.Time) (BalanceCrossCheck, error) {
+	rate, err := h.BurnRate(currency, window, now)
+	if err != nil {
+		return BalanceCrossCheck{}, err
+	}
+
+	totals, err := ledger.Totals(LedgerQuery{Since: rate.Since, Until: rate.Until})
+	if err != nil {
+		return BalanceCrossCheck{}, err
+	}
+
+	cost := totals.Cost.In(Currency(currency))
+	return BalanceCrossCheck{
+		BurnRate:   rate,
+		LedgerCost: cost,
+		Difference: rate.Spent.Float64() - cost,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package deepseek_test
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+)
+
+func balanceResponse(granted, toppedUp string) *deepseek.UserBalanceResponse {
+	total := deepseek.MustParseDecimal(granted).Add(deepseek.MustParseDecimal(toppedUp))
+	return &deepseek.UserBalanceResponse{
+		IsAvailable: true,
+		BalanceInfos: []deepseek.UserBalanceInfo{
+			{Currency: "USD", TotalBalance: total.String(), GrantedBalance: granted, ToppedUpBalance: toppedUp},
+		},
+	}
+}
+
+func TestBalanceHistory(t *testing.T) {
+	history := deepseek.NewBalanceHistory(filepath.Join(t.TempDir(), "balances.jsonl"))
+	start := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := history.BurnRate("USD", time.Hour, start); !errors.Is(err, deepseek.ErrNotEnoughSnapshots) {
+		t.Fatalf("BurnRate() without snapshots error = %v; want ErrNotEnoughSnapshots", err)
+	}
+
+	balances := []*deepseek.UserBalanceResponse{
+		balanceResponse("2.00", "10.00"),
+		balanceResponse("1.00", "10.00"),
+		balanceResponse("0.00", "9.00"),
+		// Top-up of 10.00 while 1.00 is spent.
+		balanceResponse("0.00", "18.00"),
+	}
+	for i, balance := range balances {
+		if _, err := history.Record(balance, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	now := start.Add(3 * time.Hour)
+	rate, err := history.BurnRate("USD", 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("BurnRate() error = %v", err)
+	}
+	if rate.SpentGranted.String() != "2.00" || rate.SpentToppedUp.String() != "1.00" || rate.ToppedUp.String() != "9.00" {
+		t.Errorf("BurnRate() = granted %s, topped-up %s, top-ups %s", rate.SpentGranted, rate.SpentToppedUp, rate.ToppedUp)
+	}
+	if rate.PerHour != 1 {
+		t.Errorf("PerHour = %g; want 1", rate.PerHour)
+	}
+
+	forecast, err := history.Forecast("USD", 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("Forecast() error = %v", err)
+	}
+	if want := now.Add(18 * time.Hour); !forecast.DepletesAt.Equal(want) {
+		t.Errorf("DepletesAt = %s; want %s", forecast.DepletesAt, want)
+	}
+
+	ledger := deepseek.NewLedger(deepseek.NewMemorySink())
+	if err := ledger.Record(deepseek.UsageRecord{Time: start.Add(time.Hour), Model: deepseek.DeepSeekChat, Cost: deepseek.Amount{USD: 2.5}}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	check, err := history.CrossCheck(ledger, "USD", 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("CrossCheck() error = %v", err)
+	}
+	if check.LedgerCost != 2.5 || math.Abs(check.Difference-0.5) > 1e-9 {
+		t.Errorf("CrossCheck() = ledger %g, difference %g", check.LedgerCost, check.Difference)
+	}
+}
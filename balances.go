@@ -1,6 +1,7 @@
 package deepseek
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/roushou/deepseek/internal/http_client"
@@ -34,3 +35,53 @@ type UserBalanceInfo struct {
 	GrantedBalance  string `json:"granted_balance"`
 	ToppedUpBalance string `json:"topped_up_balance"`
 }
+
+// Total returns the total available balance, including granted and topped-up balances.
+func (b UserBalanceInfo) Total() (Decimal, error) {
+	return ParseDecimal(b.TotalBalance)
+}
+
+// Granted returns the total not expired granted balance.
+func (b UserBalanceInfo) Granted() (Decimal, error) {
+	return ParseDecimal(b.GrantedBalance)
+}
+
+// ToppedUp returns the total topped-up balance.
+func (b UserBalanceInfo) ToppedUp() (Decimal, error) {
+	return ParseDecimal(b.ToppedUpBalance)
+}
+
+// BalanceSummary is the balance of a currency.
+type BalanceSummary struct {
+	Currency string  `json:"currency"`
+	Total    Decimal `json:"total"`
+	Granted  Decimal `json:"granted"`
+	ToppedUp Decimal `json:"topped_up"`
+}
+
+// Summaries returns the balances by currency, summing the balance infos sharing a currency.
+func (r UserBalanceResponse) Summaries() (map[string]BalanceSummary, error) {
+	summaries := make(map[string]BalanceSummary, len(r.BalanceInfos))
+	for _, info := range r.BalanceInfos {
+		total, err := info.Total()
+		if err != nil {
+			return nil, fmt.Errorf("total balance: %w", err)
+		}
+		granted, err := info.Granted()
+		if err != nil {
+			return nil, fmt.Errorf("granted balance: %w", err)
+		}
+		toppedUp, err := info.ToppedUp()
+		if err != nil {
+			return nil, fmt.Errorf("topped-up balance: %w", err)
+		}
+
+		summary := summaries[info.Currency]
+		summary.Currency = info.Currency
+		summary.Total = summary.Total.Add(total)
+		summary.Granted = summary.Granted.Add(granted)
+		summary.ToppedUp = summary.ToppedUp.Add(toppedUp)
+		summaries[info.Currency] = summary
+	}
+	return summaries, nil
+}
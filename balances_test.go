@@ -0,0 +1,150 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{input: "110.00", expected: "110.00"},
+		{input: "0.1", expected: "0.1"},
+		{input: "-3.50", expected: "-3.50"},
+		{input: "42", expected: "42"},
+		{input: "", wantErr: true},
+		{input: "1e3", wantErr: true},
+		{input: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := deepseek.ParseDecimal(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDecimal(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got.String() != tt.expected {
+			t.Errorf("ParseDecimal(%q) = %s; want %s", tt.input, got, tt.expected)
+		}
+	}
+
+	// 0.1 + 0.2 is exactly 0.3, unlike with floats.
+	sum := deepseek.MustParseDecimal("0.1").Add(deepseek.MustParseDecimal("0.2"))
+	if sum.Cmp(deepseek.MustParseDecimal("0.3")) != 0 {
+		t.Errorf("0.1 + 0.2 = %s; want 0.3", sum)
+	}
+}
+
+func TestBalanceSummaries(t *testing.T) {
+	balance := deepseek.UserBalanceResponse{
+		IsAvailable: true,
+		BalanceInfos: []deepseek.UserBalanceInfo{
+			{Currency: "CNY", TotalBalance: "110.00", GrantedBalance: "10.00", ToppedUpBalance: "100.00"},
+			{Currency: "USD", TotalBalance: "5.10", GrantedBalance: "0.00", ToppedUpBalance: "5.10"},
+			{Currency: "USD", TotalBalance: "0.20", GrantedBalance: "0.20", ToppedUpBalance: "0.00"},
+		},
+	}
+
+	summaries, err := balance.Summaries()
+	if err != nil {
+		t.Fatalf("Summaries() error = %v", err)
+	}
+	if got := summaries["USD"].Total.String(); got != "5.30" {
+		t.Errorf("USD total = %s; want 5.30", got)
+	}
+	if got := summaries["CNY"].Granted.String(); got != "10.00" {
+		t.Errorf("CNY granted = %s; want 10.00", got)
+	}
+
+	balance.BalanceInfos[0].TotalBalance = "invalid"
+	if _, err := balance.Summaries(); err == nil {
+		t.Errorf("Summaries() expected an error for an invalid balance")
+	}
+}
+
+func TestBalanceGuard(t *testing.T) {
+	total := atomic.Value{}
+	total.Store("10.00")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/user/balance" {
+			fmt.Fprintf(w, `{"is_available":true,"balance_infos":[{"currency":"USD","total_balance":%q,"granted_balance":"0.00","topped_up_balance":%[1]q}]}`, total.Load())
+			return
+		}
+		fmt.Fprint(w, `{"id":"1","model":"deepseek-chat","choices":[]}`)
+	}))
+	defer server.Close()
+
+	var crossed atomic.Int32
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL), deepseek.WithBalanceGuard(deepseek.BalanceGuardConfig{
+		Thresholds: []deepseek.BalanceThreshold{{
+			Currency: "USD",
+			Amount:   deepseek.MustParseDecimal("5"),
+			OnCross:  func(deepseek.BalanceSummary) { crossed.Add(1) },
+		}},
+		Block:  true,
+		Floors: map[string]deepseek.Decimal{"USD": deepseek.MustParseDecimal("1")},
+		Clock:  clock,
+	}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	// The guard polls the balance as soon as the client is created, then at every interval.
+	clock.BlockUntil(1)
+	if balance, updatedAt := client.BalanceGuard.Balance(); balance == nil || !updatedAt.Equal(clock.Now()) {
+		t.Fatalf("Balance() = %v, %s; want the balance polled by NewClient", balance, updatedAt)
+	}
+	total.Store("0.50")
+	clock.Advance(5 * time.Minute)
+	clock.BlockUntil(1)
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat}); err == nil {
+		t.Fatalf("CreateCompletion() after polling a low balance error = nil")
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	_, polledAt := client.BalanceGuard.Balance()
+	clock.Advance(5 * time.Minute)
+	if _, updatedAt := client.BalanceGuard.Balance(); !updatedAt.Equal(polledAt) {
+		t.Errorf("Balance() polled at %s after Close()", updatedAt)
+	}
+	crossed.Store(0)
+
+	args := deepseek.CompletionArgs{Model: deepseek.DeepSeekChat}
+	for _, balance := range []string{"10.00", "4.00", "3.00"} {
+		total.Store(balance)
+		if err := client.BalanceGuard.Refresh(); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+		if _, err := client.Chats.CreateCompletion(context.Background(), args); err != nil {
+			t.Errorf("CreateCompletion() with a balance of %s error = %v", balance, err)
+		}
+	}
+	if got := crossed.Load(); got != 1 {
+		t.Errorf("OnCross called %d times; want 1", got)
+	}
+
+	total.Store("0.50")
+	if err := client.BalanceGuard.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	_, err = client.Chats.CreateCompletion(context.Background(), args)
+	var lowBalance *deepseek.ErrLowBalance
+	if !errors.As(err, &lowBalance) || lowBalance.Currency != "USD" || lowBalance.Balance.String() != "0.50" {
+		t.Errorf("CreateCompletion() error = %v; want ErrLowBalance", err)
+	}
+}
@@ -0,0 +1,419 @@
+package deepseek
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// BatchRequest is a line of a batch input file.
+type BatchRequest struct {
+	// CustomID identifies the request in the results. It must be unique in a batch.
+	CustomID string `json:"custom_id"`
+
+	// Body is the completion requested.
+	Body CompletionArgs `json:"body"`
+}
+
+// BatchResult is a line of a batch output file.
+type BatchResult struct {
+	CustomID string `json:"custom_id"`
+
+	// Response is the completion, nil if the request failed.
+	Response *CompletionResponse `json:"response,omitempty"`
+
+	// Error is the error of the last attempt if the request failed.
+	Error string `json:"error,omitempty"`
+
+	// Attempts is the number of times the request was sent.
+	Attempts int `json:"attempts"`
+
+	// Latency is the duration of the successful attempt, or of the last one if the request failed.
+	Latency time.Duration `json:"latency"`
+
+	// Cost is the cost of the completion.
+	Cost Amount `json:"cost"`
+}
+
+// BatchConfig configures a BatchRunner.
+type BatchConfig struct {
+	// Concurrency is the maximum number of requests in flight. Defaults to 4.
+	Concurrency int
+
+	// RequestsPerMinute limits the rate at which requests, including retries, are sent. Zero means no limit.
+	RequestsPerMinute int
+
+	// MaxRetries is the number of times a failed request is retried. Defaults to 3, a negative value disables retries.
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, doubled for every following retry. Defaults to 1 second.
+	RetryBackoff time.Duration
+
+	// MaxRetryBackoff caps the delay between retries. Defaults to 1 minute.
+	MaxRetryBackoff time.Duration
+
+	// Retryable reports whether a failed request is retried. Defaults to IsRetryable.
+	Retryable func(err error) bool
+
+	// OnResult is called with every result once written, e.g. to report progress. It must be safe for concurrent use.
+	OnResult func(result BatchResult)
+
+	// Logger logs the retries and failed requests when not nil.
+	Logger *slog.Logger
+}
+
+// BatchSummary summarizes a batch run.
+type BatchSummary struct {
+	// Requests is the number of requests in the batch.
+	Requests int `json:"requests"`
+
+	// Skipped is the number of requests skipped because they completed in a previous run.
+	Skipped int `json:"skipped"`
+
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+
+	// Retries is the number of retried attempts.
+	Retries int `json:"retries"`
+
+	// Duration is the wall time of the run.
+	Duration time.Duration `json:"duration"`
+
+	// Usage aggregates the usage and cost of the requests sent by the run.
+	Usage UsageTotals `json:"usage"`
+}
+
+// BatchRunner runs batches of completion requests.
+type BatchRunner struct {
+	chats  ChatCompleter
+	config BatchConfig
+}
+
+// NewBatchRunner creates a batch runner sending the requests to chats.
+func NewBatchRunner(chats ChatCompleter, config BatchConfig) *BatchRunner {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = time.Second
+	}
+	if config.MaxRetryBackoff <= 0 {
+		config.MaxRetryBackoff = time.Minute
+	}
+	if config.Retryable == nil {
+		config.Retryable = IsRetryable
+	}
+	return &BatchRunner{chats: chats, config: config}
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying: rate limits, server errors and timeouts.
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrRateLimitExceeded) || errors.Is(err, ErrServer) || errors.Is(err, ErrServiceUnavailable) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// RunFile runs the requests of the JSONL file at inputPath and appends the results to the JSONL file at outputPath.
+//
+// The run is resumable: requests with a successful result in the output file are skipped, so an interrupted run can be
+// started again with the same files. Failed requests are sent again, the last result of a request being authoritative.
+func (r *BatchRunner) RunFile(ctx context.Context, inputPath, outputPath string) (BatchSummary, error) {
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return BatchSummary{}, err
+	}
+	requests, err := ReadBatchRequests(input)
+	input.Close()
+	if err != nil {
+		return BatchSummary{}, fmt.Errorf("%s: %w", inputPath, err)
+	}
+
+	completed, err := completedBatchRequests(outputPath)
+	if err != nil {
+		return BatchSummary{}, fmt.Errorf("%s: %w", outputPath, err)
+	}
+	pending := requests[:0:0]
+	for _, request := range requests {
+		if !completed[request.CustomID] {
+			pending = append(pending, request)
+		}
+	}
+
+	output, err := os.OpenFile(outputPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return BatchSummary{}, err
+	}
+	summary, err := r.Run(ctx, pending, output)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	summary.Requests = len(requests)
+	summary.Skipped = len(requests) - len(pending)
+	return summary, err
+}
+
+// Run sends the requests and writes their results to out as JSONL, in completion order.
+//
+// When ctx is done, no more requests are sent and the requests interrupted aren't written, so that a resumed run sends
+// them again. The summary of the requests written so far is returned with the error of ctx.
+func (r *BatchRunner) Run(ctx context.Context, requests []BatchRequest, out io.Writer) (BatchSummary, error) {
+	start := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var pace *pacer
+	if r.config.RequestsPerMinute > 0 {
+		pace = &pacer{interval: time.Minute / time.Duration(r.config.RequestsPerMinute)}
+	}
+
+	var (
+		mu       sync.Mutex
+		summary  = BatchSummary{Requests: len(requests)}
+		encoder  = json.NewEncoder(out)
+		writeErr error
+	)
+	write := func(result BatchResult, args CompletionArgs) {
+		mu.Lock()
+		defer mu.Unlock()
+		if writeErr != nil {
+			return
+		}
+		if err := encoder.Encode(result); err != nil {
+			writeErr = err
+			cancel()
+			return
+		}
+
+		record := UsageRecord{Model: args.Model, Latency: result.Latency, Cost: result.Cost, Error: result.Error}
+		if result.Response != nil {
+			record.Usage = result.Response.Usage
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+		summary.Retries += result.Attempts - 1
+		summary.Usage.Add(record)
+
+		if r.config.OnResult != nil {
+			r.config.OnResult(result)
+		}
+	}
+
+	queue := make(chan BatchRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < r.config.Concurrency && i < len(requests); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for request := range queue {
+				result, ok := r.send(ctx, pace, request)
+				if ok {
+					write(result, request.Body)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, request := range requests {
+		select {
+		case queue <- request:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	summary.Duration = time.Since(start)
+	if writeErr != nil {
+		return summary, writeErr
+	}
+	return summary, ctx.Err()
+}
+
+// send sends a request until it succeeds or its retries are exhausted. It reports false if the request was interrupted
+// because ctx is done.
+func (r *BatchRunner) send(ctx context.Context, pace *pacer, request BatchRequest) (BatchResult, bool) {
+	result := BatchResult{CustomID: request.CustomID}
+	backoff := r.config.RetryBackoff
+	for {
+		if err := pace.wait(ctx); err != nil {
+			return result, false
+		}
+
+		result.Attempts++
+		start := time.Now()
+		completion, err := r.chats.CreateCompletion(ctx, request.Body)
+		result.Latency = time.Since(start)
+		if err == nil {
+			result.Response = completion
+			result.Cost = completion.Cost()
+			result.Error = ""
+			return result, true
+		}
+		if ctx.Err() != nil {
+			return result, false
+		}
+
+		result.Error = err.Error()
+		if result.Attempts > r.config.MaxRetries || !r.config.Retryable(err) {
+			r.log(ctx, slog.LevelError, "batch request failed", request, result.Attempts, err)
+			return result, true
+		}
+		r.log(ctx, slog.LevelWarn, "retrying batch request", request, result.Attempts, err, slog.Duration("backoff", backoff))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return result, false
+		}
+		backoff = min(2*backoff, r.config.MaxRetryBackoff)
+	}
+}
+
+func (r *BatchRunner) log(ctx context.Context, level slog.Level, msg string, request BatchRequest, attempts int, err error, extra ...slog.Attr) {
+	if r.config.Logger == nil {
+		return
+	}
+	attrs := append([]slog.Attr{
+		slog.String("custom_id", request.CustomID),
+		slog.String("model", string(request.Body.Model)),
+		slog.Int("attempts", attempts),
+		slog.Any("error", err),
+	}, extra...)
+	r.config.Logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ReadBatchRequests reads JSONL batch requests. Every request must have a unique custom ID.
+func ReadBatchRequests(r io.Reader) ([]BatchRequest, error) {
+	var requests []BatchRequest
+	ids := make(map[string]int)
+	err := readJSONL(r, func(line int, data []byte) error {
+		var request BatchRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if request.CustomID == "" {
+			return fmt.Errorf("line %d: missing custom_id", line)
+		}
+		if previous, ok := ids[request.CustomID]; ok {
+			return fmt.Errorf("line %d: custom_id %q already used on line %d", line, request.CustomID, previous)
+		}
+		ids[request.CustomID] = line
+		requests = append(requests, request)
+		return nil
+	})
+	return requests, err
+}
+
+// ReadBatchResults reads JSONL batch results.
+func ReadBatchResults(r io.Reader) ([]BatchResult, error) {
+	var results []BatchResult
+	err := readJSONL(r, func(line int, data []byte) error {
+		var result BatchResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		results = append(results, result)
+		return nil
+	})
+	return results, err
+}
+
+// completedBatchRequests returns the IDs of the requests with a successful result in the output file at path.
+//
+// A last line left incomplete by a crash is truncated so that new results can be appended.
+func completedBatchRequests(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if n := bytes.LastIndexByte(data, '\n') + 1; n < len(data) {
+		data = data[:n]
+		if err := os.Truncate(path, int64(n)); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := ReadBatchResults(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	completed := make(map[string]bool, len(results))
+	for _, result := range results {
+		completed[result.CustomID] = result.Response != nil
+	}
+	return completed, nil
+}
+
+// readJSONL calls fn with every non-empty line of r and its number.
+func readJSONL(r io.Reader, fn func(line int, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := fn(line, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// pacer spaces out events by a fixed interval. A nil pacer doesn't wait.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next slot or until ctx is done.
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return ctx.Err()
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,137 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+)
+
+// flakyChats fails the first attempts of the requests whose first message is in failures.
+type flakyChats struct {
+	mu       sync.Mutex
+	failures map[string]int
+	calls    map[string]int
+}
+
+func (f *flakyChats) CreateCompletion(ctx context.Context, args deepseek.CompletionArgs) (*deepseek.CompletionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prompt := args.Messages[0].Content
+	f.calls[prompt]++
+	if f.failures[prompt] > 0 {
+		f.failures[prompt]--
+		return nil, deepseek.ErrServiceUnavailable
+	}
+	if prompt == "invalid" {
+		return nil, deepseek.ErrInvalidParameters
+	}
+	return &deepseek.CompletionResponse{
+		Model:   args.Model,
+		Choices: []deepseek.CompletionChoice{{Message: deepseek.Message{Role: deepseek.AssistantRole, Content: "re: " + prompt}}},
+		Usage:   deepseek.CompletionUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+func TestBatchRunner(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "requests.jsonl")
+	output := filepath.Join(dir, "results.jsonl")
+	lines := []string{
+		`{"custom_id": "a", "body": {"model": "deepseek-chat", "messages": [{"role": "user", "content": "one"}]}}`,
+		`{"custom_id": "b", "body": {"model": "deepseek-chat", "messages": [{"role": "user", "content": "two"}]}}`,
+		``,
+		`{"custom_id": "c", "body": {"model": "deepseek-chat", "messages": [{"role": "user", "content": "invalid"}]}}`,
+		`{"custom_id": "d", "body": {"model": "deepseek-chat", "messages": [{"role": "user", "content": "four"}]}}`,
+	}
+	if err := os.WriteFile(input, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A previous run completed "a" and crashed while writing "b".
+	previous := `{"custom_id": "a", "response": {"model": "deepseek-chat"}, "attempts": 1}` + "\n" + `{"custom_id": "b", "resp`
+	if err := os.WriteFile(output, []byte(previous), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	chats := &flakyChats{failures: map[string]int{"two": 2}, calls: map[string]int{}}
+	runner := deepseek.NewBatchRunner(chats, deepseek.BatchConfig{RetryBackoff: time.Millisecond})
+	summary, err := runner.RunFile(context.Background(), input, output)
+	if err != nil {
+		t.Fatalf("RunFile() error = %v", err)
+	}
+
+	if summary.Requests != 4 || summary.Skipped != 1 || summary.Succeeded != 2 || summary.Failed != 1 || summary.Retries != 2 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if summary.Usage.TotalTokens != 30 || summary.Usage.Cost.USD <= 0 {
+		t.Errorf("summary usage = %+v", summary.Usage)
+	}
+	if chats.calls["one"] != 0 || chats.calls["two"] != 3 || chats.calls["invalid"] != 1 {
+		t.Errorf("calls = %v", chats.calls)
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	results, err := deepseek.ReadBatchResults(file)
+	if err != nil {
+		t.Fatalf("ReadBatchResults() error = %v", err)
+	}
+	byID := make(map[string]deepseek.BatchResult)
+	for _, result := range results {
+		byID[result.CustomID] = result
+	}
+	if len(results) != 4 {
+		t.Fatalf("results = %+v; want 4", results)
+	}
+	if got := byID["b"]; got.Response == nil || got.Response.Choices[0].Message.Content != "re: two" || got.Attempts != 3 {
+		t.Errorf("result b = %+v", got)
+	}
+	if got := byID["c"]; got.Response != nil || got.Attempts != 1 || !strings.Contains(got.Error, deepseek.ErrInvalidParameters.Error()) {
+		t.Errorf("result c = %+v; want a failure without retries", got)
+	}
+
+	// A resumed run only retries the failed request.
+	summary, err = runner.RunFile(context.Background(), input, output)
+	if err != nil {
+		t.Fatalf("RunFile() error = %v", err)
+	}
+	if summary.Skipped != 3 || summary.Failed != 1 {
+		t.Errorf("resumed summary = %+v", summary)
+	}
+}
+
+func TestReadBatchRequests(t *testing.T) {
+	_, err := deepseek.ReadBatchRequests(strings.NewReader(`{"custom_id": "a", "body": {}}` + "\n" + `{"custom_id": "a", "body": {}}`))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ReadBatchRequests() error = %v; want a duplicate custom_id error", err)
+	}
+	_, err = deepseek.ReadBatchRequests(strings.NewReader(`{"body": {}}`))
+	if err == nil {
+		t.Errorf("ReadBatchRequests() error = nil; want a missing custom_id error")
+	}
+}
+
+func TestBatchRunnerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out strings.Builder
+	chats := &flakyChats{calls: map[string]int{}}
+	requests := []deepseek.BatchRequest{{CustomID: "a", Body: deepseek.CompletionArgs{Messages: []deepseek.Message{{Content: "one"}}}}}
+	_, err := deepseek.NewBatchRunner(chats, deepseek.BatchConfig{}).Run(ctx, requests, &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v; want context.Canceled", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("output = %q; want nothing written", out.String())
+	}
+}
@@ -0,0 +1,28 @@
+package deepseek
+
+import "github.com/roushou/deepseek/internal/http_client"
+
+// Circuit breaker types, see WithCircuitBreaker.
+type (
+	CircuitBreaker       = http_client.CircuitBreaker
+	CircuitBreakerConfig = http_client.CircuitBreakerConfig
+	CircuitScope         = http_client.CircuitScope
+	CircuitState         = http_client.CircuitState
+
+	// ErrCircuitOpen is returned without sending the request while the circuit of its base URL and model is open, to
+	// be checked with errors.As.
+	ErrCircuitOpen = http_client.ErrCircuitOpen
+)
+
+// States of a circuit.
+const (
+	CircuitClosed   = http_client.CircuitClosed
+	CircuitOpen     = http_client.CircuitOpen
+	CircuitHalfOpen = http_client.CircuitHalfOpen
+)
+
+// IsCircuitFailure reports whether err counts as a failure of the API for the circuit breaker: server errors and
+// timeouts.
+func IsCircuitFailure(err error) bool {
+	return http_client.IsCircuitFailure(err)
+}
@@ -0,0 +1,53 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(
+		deepseektest.Error(http.StatusInternalServerError, "boom"),
+		deepseektest.Error(http.StatusInternalServerError, "boom"),
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello!"),
+	)
+
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithCircuitBreaker(deepseek.CircuitBreakerConfig{
+		MinRequests: 2,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete := func(model deepseek.ModelID) error {
+		_, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+			Model:    model,
+			Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+		})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := complete(deepseek.DeepSeekReasoner); !errors.Is(err, deepseek.ErrServer) {
+			t.Fatalf("error = %v; want ErrServer", err)
+		}
+	}
+	var open *deepseek.ErrCircuitOpen
+	if err := complete(deepseek.DeepSeekReasoner); !errors.As(err, &open) || open.Scope.Model != string(deepseek.DeepSeekReasoner) {
+		t.Fatalf("error = %v; want ErrCircuitOpen for the reasoner", err)
+	}
+	if state := client.CircuitBreaker.State(open.Scope); state != deepseek.CircuitOpen {
+		t.Errorf("state = %s; want open", state)
+	}
+
+	// The circuit of the other model is still closed.
+	if err := complete(deepseek.DeepSeekChat); err != nil {
+		t.Fatal(err)
+	}
+	server.AssertDrained()
+}
@@ -0,0 +1,426 @@
+package deepseek
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// CacheStore stores cached responses. Values are opaque to the store.
+type CacheStore interface {
+	// Get returns the value of key, reporting false when it is missing or expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores the value of key for ttl, zero meaning no expiry.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context whose requests skip the ResponseCache: they are neither answered from nor stored in it.
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+// ResponseCacheConfig configures a ResponseCache.
+type ResponseCacheConfig struct {
+	// TTL is how long responses are cached. Zero means no expiry.
+	TTL time.Duration
+
+	// CacheSampled caches the requests with a positive Temperature, whose responses are normally expected to vary.
+	// Requests without a Temperature are sampled with the default of the API, 1.
+	CacheSampled bool
+
+	// OnError is called with the errors of the store. The request is then sent as if the cache was missed.
+	OnError func(err error)
+}
+
+// ResponseCacheStats are statistics of a ResponseCache.
+type ResponseCacheStats struct {
+	Hits   int64
+	Misses int64
+
+	// Skipped is the number of requests not eligible for caching, see ResponseCacheConfig.CacheSampled and WithCacheBypass.
+	Skipped int64
+}
+
+// ResponseCache answers identical requests with cached responses, see Middleware.
+//
+// Requests are identified by a hash of their parameters, so that a streaming and a non-streaming request with the same
+// parameters share their cached response. Cached responses are replayed to streaming requests as a synthetic stream.
+type ResponseCache struct {
+	store  CacheStore
+	config ResponseCacheConfig
+
+	mu    sync.Mutex
+	stats ResponseCacheStats
+}
+
+// cachedResponse is the value stored for a request.
+type cachedResponse struct {
+	Response CompletionResponse `json:"response"`
+
+	// Reasoning is the reasoning content of the choices of streamed completions, missing from CompletionResponse.
+	Reasoning map[int64]string `json:"reasoning,omitempty"`
+}
+
+// NewResponseCache creates a response cache keeping the responses in store.
+func NewResponseCache(store CacheStore, config ResponseCacheConfig) *ResponseCache {
+	return &ResponseCache{store: store, config: config}
+}
+
+// CacheKey returns the key identifying a request in a ResponseCache: a hash of its model, messages, sampling parameters and tools.
+func CacheKey(args CompletionArgs) (string, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Stats returns the statistics of the cache.
+func (c *ResponseCache) Stats() ResponseCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Middleware returns a middleware answering from the cache and caching successful responses. Streamed responses are
+// only cached once every choice of the stream finished.
+func (c *ResponseCache) Middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				key, cached := c.lookup(ctx, args)
+				if cached != nil {
+					response := cached.Response
+					return &response, nil
+				}
+
+				completion, err := next.CreateCompletion(ctx, args)
+				if err == nil && key != "" {
+					c.save(ctx, key, cachedResponse{Response: *completion})
+				}
+				return completion, err
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				key, cached := c.lookup(ctx, args.completionArgs())
+				if cached != nil {
+					includeUsage := args.StreamOptions != nil && args.StreamOptions.IncludeUsage
+					return replayStream(*cached, includeUsage)
+				}
+
+				stream := next.CreateStreamCompletion(ctx, args)
+				if key == "" {
+					return stream
+				}
+				var acc StreamAccumulator
+				stream.OnChunk(acc.Add)
+				stream.OnDone(func(err error) {
+					response := acc.Response()
+					if err != nil || !finished(response) {
+						return
+					}
+					cached := cachedResponse{Response: response, Reasoning: map[int64]string{}}
+					for _, choice := range response.Choices {
+						if reasoning := acc.ReasoningContent(choice.Index); reasoning != "" {
+							cached.Reasoning[choice.Index] = reasoning
+						}
+					}
+					c.save(context.WithoutCancel(ctx), key, cached)
+				})
+				return stream
+			},
+		}
+	}
+}
+
+// lookup returns the key of a cacheable request and its cached response, if any. The key is empty when the request
+// must not be cached.
+func (c *ResponseCache) lookup(ctx context.Context, args CompletionArgs) (string, *cachedResponse) {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	if bypass || !c.config.CacheSampled && (args.Temperature == nil || *args.Temperature > 0) {
+		c.count(func(stats *ResponseCacheStats) { stats.Skipped++ })
+		return "", nil
+	}
+
+	key, err := CacheKey(args)
+	if err != nil {
+		c.fail(err)
+		return "", nil
+	}
+	value, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.fail(err)
+	}
+	if ok {
+		var cached cachedResponse
+		if err := json.Unmarshal(value, &cached); err == nil {
+			c.count(func(stats *ResponseCacheStats) { stats.Hits++ })
+			return key, &cached
+		}
+		c.fail(fmt.Errorf("decode cached response: %w", err))
+	}
+	c.count(func(stats *ResponseCacheStats) { stats.Misses++ })
+	return key, nil
+}
+
+func (c *ResponseCache) save(ctx context.Context, key string, cached cachedResponse) {
+	value, err := json.Marshal(cached)
+	if err == nil {
+		err = c.store.Set(ctx, key, value, c.config.TTL)
+	}
+	if err != nil {
+		c.fail(err)
+	}
+}
+
+func (c *ResponseCache) count(fn func(stats *ResponseCacheStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(&c.stats)
+}
+
+func (c *ResponseCache) fail(err error) {
+	if c.config.OnError != nil {
+		c.config.OnError(err)
+	}
+}
+
+// finished reports whether every choice of a streamed response has a finish reason.
+func finished(response CompletionResponse) bool {
+	if len(response.Choices) == 0 {
+		return false
+	}
+	for _, choice := range response.Choices {
+		if choice.FinishReason == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// replayStream returns a stream of the cached response, framed as Server-Sent Events like the API does.
+func replayStream(cached cachedResponse, includeUsage bool) *ssestream.Stream[StreamCompletionChunk] {
+	response := cached.Response
+	chunk := func() StreamCompletionChunk {
+		return StreamCompletionChunk{
+			ID:                response.ID,
+			Model:             response.Model,
+			Created:           response.Created,
+			SystemFingerprint: response.SystemFingerprint,
+			Object:            "chat.completion.chunk",
+		}
+	}
+
+	var chunks []StreamCompletionChunk
+	for _, choice := range response.Choices {
+		c := chunk()
+		delta := StreamDelta{
+			Role:             choice.Message.Role,
+			Content:          choice.Message.Content,
+			ReasoningContent: cached.Reasoning[choice.Index],
+		}
+		for i, call := range choice.Message.ToolCalls {
+			delta.ToolCalls = append(delta.ToolCalls, StreamToolCall{Index: int64(i), ID: call.ID, Type: call.Type, Function: call.Function})
+		}
+		c.Choices = []StreamCompletionChoice{{Index: choice.Index, Delta: delta, FinishReason: choice.FinishReason}}
+		chunks = append(chunks, c)
+	}
+	if includeUsage {
+		c := chunk()
+		c.Choices = []StreamCompletionChoice{}
+		c.Usage = &response.Usage
+		chunks = append(chunks, c)
+	}
+
+	var body bytes.Buffer
+	for _, c := range chunks {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return ssestream.NewStream[StreamCompletionChunk](nil, err)
+		}
+		fmt.Fprintf(&body, "data: %s\n\n", data)
+	}
+	body.WriteString("data: [DONE]\n\n")
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(&body),
+	}
+	return ssestream.NewStream[StreamCompletionChunk](ssestream.NewDecoder(resp), nil)
+}
+
+// MemoryCache is an in-memory CacheStore evicting the least recently used entries beyond its capacity.
+type MemoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+	now      func() time.Time
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates an in-memory cache holding up to capacity entries, zero meaning no limit.
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		now:      time.Now,
+	}
+}
+
+func (c *MemoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoryCacheEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expiresAt = c.now().Add(ttl)
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.capacity > 0 && c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including the expired ones not evicted yet.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// DirCache is a CacheStore keeping every entry in a JSON file of a directory, so that it persists across processes.
+type DirCache struct {
+	dir string
+	now func() time.Time
+}
+
+type dirCacheEntry struct {
+	ExpiresAt time.Time       `json:"expires_at"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// NewDirCache creates a cache in dir, creating the directory if needed.
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirCache{dir: dir, now: time.Now}, nil
+}
+
+func (c *DirCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var entry dirCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+	if !entry.ExpiresAt.IsZero() && !c.now().Before(entry.ExpiresAt) {
+		_ = os.Remove(path)
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+func (c *DirCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := dirCacheEntry{Value: value}
+	if ttl > 0 {
+		entry.ExpiresAt = c.now().Add(ttl)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Entries are written to a temporary file renamed into place, so that readers never see partial entries.
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// Prune removes the expired entries.
+func (c *DirCache) Prune() error {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		key := strings.TrimSuffix(filepath.Base(path), ".json")
+		if _, _, err := c.Get(context.Background(), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DirCache) path(key string) string {
+	return filepath.Join(c.dir, filepath.Base(key)+".json")
+}
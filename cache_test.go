@@ -0,0 +1,186 @@
+package deepseek_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func TestResponseCache(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	cache := deepseek.NewResponseCache(deepseek.NewMemoryCache(10), deepseek.ResponseCacheConfig{
+		OnError: func(err error) { t.Errorf("cache error = %v", err) },
+	})
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL), deepseek.WithChatMiddleware(cache.Middleware()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	server.Enqueue(
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello World"),
+		deepseektest.Text(deepseek.DeepSeekChat, "Sampled"),
+		deepseektest.Text(deepseek.DeepSeekChat, "Default temperature"),
+		deepseektest.Text(deepseek.DeepSeekChat, "Bypassed"),
+	)
+
+	args := deepseek.CompletionArgs{
+		Model:       deepseek.DeepSeekChat,
+		Messages:    []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+		Temperature: deepseek.Float(0),
+	}
+	for i := 0; i < 2; i++ {
+		completion, err := client.Chats.CreateCompletion(context.Background(), args)
+		if err != nil {
+			t.Fatalf("CreateCompletion() #%d error = %v", i, err)
+		}
+		if got := completion.Choices[0].Message.Content; got != "Hello World" {
+			t.Errorf("content #%d = %q; want %q", i, got, "Hello World")
+		}
+	}
+	server.AssertRequestCount(1)
+
+	// A stream with the same parameters is replayed from the cache.
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{
+		Model:         args.Model,
+		Messages:      args.Messages,
+		StreamOptions: &deepseek.StreamOptions{IncludeUsage: true},
+		Temperature:   args.Temperature,
+	})
+	var acc deepseek.StreamAccumulator
+	for stream.Next() {
+		acc.Add(stream.Current())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream Err() = %v", err)
+	}
+	if got := acc.Response().Choices[0].Message.Content; got != "Hello World" {
+		t.Errorf("replayed content = %q; want %q", got, "Hello World")
+	}
+	if usage, ok := acc.Usage(); !ok || usage.TotalTokens == 0 {
+		t.Errorf("replayed Usage() = %+v, %t; want the cached usage", usage, ok)
+	}
+
+	// Sampled and bypassed requests are always sent, including the ones sampled with the default temperature.
+	sampled := args
+	sampled.Temperature = deepseek.Float(0.7)
+	if _, err := client.Chats.CreateCompletion(context.Background(), sampled); err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	sampled.Temperature = nil
+	if _, err := client.Chats.CreateCompletion(context.Background(), sampled); err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	completion, err := client.Chats.CreateCompletion(deepseek.WithCacheBypass(context.Background()), args)
+	if err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	if got := completion.Choices[0].Message.Content; got != "Bypassed" {
+		t.Errorf("bypassed content = %q; want %q", got, "Bypassed")
+	}
+
+	server.AssertRequestCount(4)
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 || stats.Skipped != 3 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestResponseCacheStream(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	store, err := deepseek.NewDirCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirCache() error = %v", err)
+	}
+	cache := deepseek.NewResponseCache(store, deepseek.ResponseCacheConfig{TTL: time.Hour})
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL), deepseek.WithChatMiddleware(cache.Middleware()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	server.Enqueue(
+		deepseektest.Stream(deepseektest.StreamScript{Chunks: deepseektest.TextChunks(deepseek.DeepSeekReasoner, "Hello World")}),
+	)
+
+	args := deepseek.StreamCompletionArgs{
+		Model:       deepseek.DeepSeekReasoner,
+		Messages:    []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+		Temperature: deepseek.Float(0),
+	}
+	for i := 0; i < 2; i++ {
+		var content strings.Builder
+		stream := client.Chats.CreateStreamCompletion(context.Background(), args)
+		for stream.Next() {
+			for _, choice := range stream.Current().Choices {
+				content.WriteString(choice.Delta.Content)
+			}
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("stream #%d Err() = %v", i, err)
+		}
+		if content.String() != "Hello World" {
+			t.Errorf("stream #%d content = %q; want %q", i, content.String(), "Hello World")
+		}
+	}
+	server.AssertRequestCount(1)
+
+	// The streamed completion also answers non-streaming requests.
+	completion, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: args.Model, Messages: args.Messages, Temperature: args.Temperature})
+	if err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	if got := completion.Choices[0].FinishReason; got != deepseek.CompletionFinishReasonStop {
+		t.Errorf("FinishReason = %q; want %q", got, deepseek.CompletionFinishReasonStop)
+	}
+	server.AssertRequestCount(1)
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	cache := deepseek.NewMemoryCache(2)
+	_ = cache.Set(ctx, "a", []byte("1"), 0)
+	_ = cache.Set(ctx, "b", []byte("2"), 0)
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Fatalf("Get(a) = false; want true")
+	}
+	// b is the least recently used entry.
+	_ = cache.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Errorf("Get(b) = true; want it evicted")
+	}
+
+	_ = cache.Set(ctx, "d", []byte("4"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "d"); ok {
+		t.Errorf("Get(d) = true; want it expired")
+	}
+	if value, ok, _ := cache.Get(ctx, "c"); !ok || string(value) != "3" {
+		t.Errorf("Get(c) = %q, %t; want 3", value, ok)
+	}
+}
+
+func TestDirCache(t *testing.T) {
+	ctx := context.Background()
+	cache, err := deepseek.NewDirCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirCache() error = %v", err)
+	}
+
+	if err := cache.Set(ctx, "a", []byte(`{"x":1}`), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := cache.Set(ctx, "b", []byte(`{}`), time.Millisecond); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := cache.Prune(); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	if value, ok, err := cache.Get(ctx, "a"); err != nil || !ok || string(value) != `{"x":1}` {
+		t.Errorf("Get(a) = %s, %t, %v", value, ok, err)
+	}
+	if _, ok, err := cache.Get(ctx, "b"); err != nil || ok {
+		t.Errorf("Get(b) = %t, %v; want it expired", ok, err)
+	}
+}
@@ -14,45 +14,57 @@ type ChatsClient struct {
 	httpClient *http_client.Client
 }
 
-func (c *ChatsClient) CreateCompletion(args CompletionArgs) (*CompletionResponse, error) {
+// CreateCompletion creates a chat completion.
+func (c *ChatsClient) CreateCompletion(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
 	body, err := json.Marshal(args)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := c.httpClient.NewRequest(http.MethodPost, "/chat/completions", bytes.NewReader(body))
+	req, err := c.httpClient.NewRequestWithContext(http_client.WithModel(ctx, string(args.Model)), http.MethodPost, "/chat/completions", bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 
 	var completion CompletionResponse
 	_, err = c.httpClient.Do(req, &completion)
-	return &completion, err
+	if err != nil {
+		return nil, err
+	}
+	return &completion, nil
 }
 
 // CreateStreamCompletion streams chat completion using Server-Sent Events (SSE).
+//
+// Errors occurring before the stream starts are reported by the Err method of the returned stream.
 func (c *ChatsClient) CreateStreamCompletion(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
 	args.Stream = true
 
 	body, err := json.Marshal(args)
 	if err != nil {
-		return nil
+		return ssestream.NewStream[StreamCompletionChunk](nil, err)
 	}
 
-	req, err := c.httpClient.NewRequest(http.MethodPost, "/chat/completions", bytes.NewReader(body))
+	req, err := c.httpClient.NewRequestWithContext(http_client.WithModel(ctx, string(args.Model)), http.MethodPost, "/chat/completions", bytes.NewReader(body))
 	if err != nil {
-		return nil
+		return ssestream.NewStream[StreamCompletionChunk](nil, err)
 	}
+	req.Header = req.Header.Clone()
 	req.Header.Set("Accept", "text/event-stream")
 
 	resp, err := c.httpClient.Do(req, nil)
 	if err != nil {
-		return nil
+		return ssestream.NewStream[StreamCompletionChunk](nil, err)
 	}
 
 	return ssestream.NewStream[StreamCompletionChunk](ssestream.NewDecoder(resp), nil)
 }
 
+// Float returns a pointer to v, for the optional parameters of the requests such as Temperature.
+func Float(v float64) *float64 {
+	return &v
+}
+
 // NewCompletionRequest creates a new chat completion request with default values.
 func NewCompletionRequest(model ModelID) CompletionArgs {
 	return CompletionArgs{
@@ -63,7 +75,7 @@ func NewCompletionRequest(model ModelID) CompletionArgs {
 		PresencePenalty:  0,
 		ResponseFormat:   &ResponseFormat{},
 		Stop:             []string{},
-		Temperature:      1,
+		Temperature:      Float(1),
 		TopP:             1,
 		Tools:            []Tool{},
 		ToolChoice:       "",
@@ -84,7 +96,7 @@ func NewStreamCompletionArgs(model ModelID) StreamCompletionArgs {
 		Stream:           true,
 		StreamOptions:    &StreamOptions{},
 		Stop:             []string{},
-		Temperature:      1,
+		Temperature:      Float(1),
 		TopP:             1,
 		Tools:            []Tool{},
 		ToolChoice:       "",
@@ -123,8 +135,8 @@ type CompletionArgs struct {
 
 	// Temperature controls the randomness of the output; higher values make it more creative, lower values more deterministic.
 	//
-	// Range: 0 to 2. Default: 1.
-	Temperature float64 `json:"temperature,omitempty"`
+	// Range: 0 to 2. Nil means the default of the API, 1. Use Float to set it, e.g. Float(0) for greedy sampling.
+	Temperature *float64 `json:"temperature,omitempty"`
 
 	// TopP implements nucleus sampling where only tokens with cumulative probability up to this value are considered.
 	//
@@ -182,8 +194,8 @@ type StreamCompletionArgs struct {
 
 	// Temperature controls the randomness of the output; higher values make it more creative, lower values more deterministic.
 	//
-	// Range: 0 to 2. Default: 1.
-	Temperature float64 `json:"temperature,omitempty"`
+	// Range: 0 to 2. Nil means the default of the API, 1. Use Float to set it, e.g. Float(0) for greedy sampling.
+	Temperature *float64 `json:"temperature,omitempty"`
 
 	// TopP implements nucleus sampling where only tokens with cumulative probability up to this value are considered.
 	//
@@ -214,6 +226,12 @@ type Message struct {
 
 	// Name is an optional name for the participant. It Provides the model information to differentiate between participants of the same role.
 	Name string `json:"name,omitempty"`
+
+	// ToolCalls are the tool calls generated by the model in an assistant message.
+	ToolCalls []CompletionToolCall `json:"tool_calls,omitempty"`
+
+	// ToolCallID is the ID of the tool call a tool message responds to.
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
 
 type Role string
@@ -256,6 +274,9 @@ type ToolFunction struct {
 
 	// Name is the name of the function.
 	Name string `json:"name"`
+
+	// Parameters is the JSON schema of the arguments accepted by the function.
+	Parameters any `json:"parameters,omitempty"`
 }
 type StreamOptions struct {
 	IncludeUsage bool `json:"include_usage,omitempty"`
@@ -282,17 +303,25 @@ type CompletionResponse struct {
 
 	// Object describes the type of this response object i.e. "chat.completion" for a simple completion and "chat.completion.chunk" for a streaming completion.
 	Object string `json:"object"`
+
+	// ServedBy is the name of the FallbackTarget that served the completion, if any. It isn't part of the API response.
+	ServedBy string `json:"-"`
 }
 
 // EstimateTokens estimates the tokens used for the completion according to the documentation https://api-docs.deepseek.com/quick_start/token_usage
 func (c CompletionResponse) EstimateTokens() int64 {
 	var tokens int64
 	for _, choice := range c.Choices {
-		tokens += estimateTokens(choice.Message.Content)
+		tokens += CountTokens(c.Model, choice.Message.Content)
 	}
 	return tokens
 }
 
+// Cost computes the cost of the completion from its usage using DefaultPrices.
+func (c CompletionResponse) Cost() Amount {
+	return Cost(c.Usage, c.Model, createdAt(c.Created))
+}
+
 type StreamCompletionChunk struct {
 	// ID is a unique identifier for the chat completion.
 	ID string `json:"id"`
@@ -311,6 +340,12 @@ type StreamCompletionChunk struct {
 
 	// Object describes the type of this response object i.e. "chat.completion" for a simple completion and "chat.completion.chunk" for a streaming completion.
 	Object string `json:"object"`
+
+	// Usage is the usage statistics for the completion request. It is only set on the last chunk when StreamOptions.IncludeUsage is enabled.
+	Usage *CompletionUsage `json:"usage,omitempty"`
+
+	// ServedBy is the name of the FallbackTarget that served the stream, if any. It isn't part of the API response.
+	ServedBy string `json:"-"`
 }
 
 type StreamCompletionChoice struct {
@@ -320,9 +355,18 @@ type StreamCompletionChoice struct {
 }
 
 type StreamDelta struct {
-	Content          string `json:"content"`
-	ReasoningContent string `json:"reasoning_content"`
-	Role             Role   `json:"role"`
+	Content          string           `json:"content"`
+	ReasoningContent string           `json:"reasoning_content"`
+	Role             Role             `json:"role"`
+	ToolCalls        []StreamToolCall `json:"tool_calls,omitempty"`
+}
+
+// StreamToolCall is a fragment of a tool call. The fragments of a tool call share the same index and their function arguments are concatenated.
+type StreamToolCall struct {
+	Index    int64                      `json:"index"`
+	ID       string                     `json:"id,omitempty"`
+	Type     ToolType                   `json:"type,omitempty"`
+	Function CompletionToolCallFunction `json:"function"`
 }
 
 type CompletionChoice struct {
@@ -2,6 +2,9 @@ package deepseek
 
 import (
 	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
 
 	"github.com/roushou/deepseek/internal/http_client"
 )
@@ -13,7 +16,22 @@ const (
 type Option func(opts *options) error
 
 type options struct {
-	baseURL string
+	baseURL      string
+	httpClient   *http.Client
+	ledger       *Ledger
+	balanceGuard *BalanceGuardConfig
+	modelCatalog *ModelCatalogConfig
+	rateLimit    *RateLimitConfig
+	singleflight bool
+	hedge        *HedgeConfig
+	keyPool      *KeyPool
+	breaker      *CircuitBreakerConfig
+	fallback     *FallbackPolicy
+	middlewares  ChatChain
+	logger       *slog.Logger
+	metrics      MetricsRecorder
+	logContent   bool
+	maxContent   int
 }
 
 func WithBaseURL(baseURL string) Option {
@@ -26,11 +44,196 @@ func WithBaseURL(baseURL string) Option {
 	}
 }
 
+// WithHTTPClient sets the HTTP client used to send requests, e.g. to use a custom transport. Defaults to http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(opts *options) error {
+		if httpClient == nil {
+			return errors.New("invalid HTTP client")
+		}
+		opts.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithLogger logs the requests of the client: the lifecycle of chat completions with their model, latency and usage,
+// fallbacks and circuit state changes, and the HTTP requests at debug level. Message content isn't logged unless
+// WithLogContent is set, and the header fields carrying credentials, e.g. Authorization or Cookie, are redacted.
+func WithLogger(logger *slog.Logger) Option {
+	return func(opts *options) error {
+		if logger == nil {
+			return errors.New("invalid logger")
+		}
+		opts.logger = logger
+		return nil
+	}
+}
+
+// WithLogContent logs the content of the messages and completions at debug level, truncated to maxLength characters
+// unless zero. It requires WithLogger, NewClient fails without it.
+func WithLogContent(maxLength int) Option {
+	return func(opts *options) error {
+		if maxLength < 0 {
+			return errors.New("invalid maximum content length")
+		}
+		opts.logContent = true
+		opts.maxContent = maxLength
+		return nil
+	}
+}
+
+// WithMetrics reports the metrics of the chat completions of the client to the recorder, e.g. ExpvarMetrics.
+func WithMetrics(recorder MetricsRecorder) Option {
+	return func(opts *options) error {
+		if recorder == nil {
+			return errors.New("invalid metrics recorder")
+		}
+		opts.metrics = recorder
+		return nil
+	}
+}
+
+// WithKeyPool authenticates the requests of the client with the keys of the pool instead of the API key given to
+// NewClient, which can then be empty. It wraps the transport of the HTTP client set WithHTTPClient, if any, and counts
+// the usage of the completions of the client in the statistics of the keys.
+func WithKeyPool(pool *KeyPool) Option {
+	return func(opts *options) error {
+		if pool == nil {
+			return errors.New("invalid key pool")
+		}
+		opts.keyPool = pool
+		return nil
+	}
+}
+
+// WithCircuitBreaker creates a CircuitBreaker failing the requests of the client fast with ErrCircuitOpen while the API
+// is failing, see Client.CircuitBreaker. Circuits are scoped to the base URL and, for chat completions, to the model.
+func WithCircuitBreaker(config CircuitBreakerConfig) Option {
+	return func(opts *options) error {
+		if config.FailureRatio < 0 || config.FailureRatio > 1 {
+			return errors.New("invalid circuit breaker failure ratio")
+		}
+		opts.breaker = &config
+		return nil
+	}
+}
+
+// WithLedger records the usage and cost of every chat completion in the ledger.
+func WithLedger(ledger *Ledger) Option {
+	return func(opts *options) error {
+		if ledger == nil {
+			return errors.New("invalid ledger")
+		}
+		opts.ledger = ledger
+		return nil
+	}
+}
+
+// WithBalanceGuard creates a BalanceGuard watching the balance of the client, see Client.BalanceGuard. The guard polls
+// the balance in the background from NewClient until the client is closed.
+//
+// Completions are rejected with ErrLowBalance when the guard is configured to block.
+func WithBalanceGuard(config BalanceGuardConfig) Option {
+	return func(opts *options) error {
+		opts.balanceGuard = &config
+		return nil
+	}
+}
+
+// WithModelCatalog creates a ModelCatalog caching the models available to the client, see Client.ModelCatalog.
+//
+// Completions for models missing from the catalog are rejected with ErrModelNotFound when the catalog is configured to reject unknown models.
+func WithModelCatalog(config ModelCatalogConfig) Option {
+	return func(opts *options) error {
+		opts.modelCatalog = &config
+		return nil
+	}
+}
+
+// WithRateLimit creates a RateLimiter applied to the chat completions of the client, see Client.RateLimiter.
+func WithRateLimit(config RateLimitConfig) Option {
+	return func(opts *options) error {
+		if config.RequestsPerMinute < 0 || config.TokensPerMinute < 0 {
+			return errors.New("invalid rate limit")
+		}
+		opts.rateLimit = &config
+		return nil
+	}
+}
+
+// WithSingleflight collapses concurrent identical chat completions of the client into a single request, see
+// Client.Singleflight. The middlewares installed by the other options, e.g. WithLogger and WithMetrics, observe the
+// request once.
+func WithSingleflight() Option {
+	return func(opts *options) error {
+		opts.singleflight = true
+		return nil
+	}
+}
+
+// WithHedging creates a Hedger sending a duplicate of the chat completions of the client that are slow to answer, see
+// Client.Hedger. Both requests go through the rate limiter configured WithRateLimit, if any.
+func WithHedging(config HedgeConfig) Option {
+	return func(opts *options) error {
+		if config.MaxHedgeRatio < 0 || config.MaxHedgeRatio > 1 || config.Budget < 0 {
+			return errors.New("invalid hedging config")
+		}
+		opts.hedge = &config
+		return nil
+	}
+}
+
+// WithFallback sends the chat completions of the client to the targets of the policy in order until one succeeds.
+// Targets with a BaseURL share the credentials and HTTP client of the client.
+func WithFallback(policy FallbackPolicy) Option {
+	return func(opts *options) error {
+		if len(policy.Targets) == 0 {
+			return errors.New("invalid fallback policy: no target")
+		}
+		opts.fallback = &policy
+		return nil
+	}
+}
+
+// WithChatMiddleware decorates the chat service of the client with the middlewares. The first middleware is the
+// outermost one, and all of them wrap the middlewares installed by the other options.
+func WithChatMiddleware(middlewares ...ChatMiddleware) Option {
+	return func(opts *options) error {
+		opts.middlewares = opts.middlewares.Append(middlewares...)
+		return nil
+	}
+}
+
+// WithHooks calls the hooks for the chat completions of the client. Like WithChatMiddleware, hooks wrap the
+// middlewares installed by the other options and the first hooks are called first.
+func WithHooks(hooks Hooks) Option {
+	return WithChatMiddleware(hooks.Middleware())
+}
+
+// Client gives access to the DeepSeek API. Its services are interfaces, so a Client can also be assembled from other
+// implementations, e.g. mocks or decorators.
 type Client struct {
 	BaseURL string
-	Balance *BalancesClient
-	Chats   *ChatsClient
-	Models  *ModelsClient
+	Balance BalanceGetter
+	Chats   ChatService
+	Models  ModelLister
+
+	// CircuitBreaker is the breaker configured WithCircuitBreaker, nil otherwise.
+	CircuitBreaker *CircuitBreaker
+
+	// BalanceGuard is the guard configured WithBalanceGuard, nil otherwise. It polls the balance until Close is called.
+	BalanceGuard *BalanceGuard
+
+	// ModelCatalog is the catalog configured WithModelCatalog, nil otherwise.
+	ModelCatalog *ModelCatalog
+
+	// RateLimiter is the limiter configured WithRateLimit, nil otherwise.
+	RateLimiter *RateLimiter
+
+	// Singleflight is the singleflight configured WithSingleflight, nil otherwise.
+	Singleflight *Singleflight
+
+	// Hedger is the hedger configured WithHedging, nil otherwise.
+	Hedger *Hedger
 }
 
 func NewClient(apiKey string, opts ...Option) (*Client, error) {
@@ -40,6 +243,9 @@ func NewClient(apiKey string, opts ...Option) (*Client, error) {
 			return nil, err
 		}
 	}
+	if options.logContent && options.logger == nil {
+		return nil, errors.New("logging content requires a logger")
+	}
 
 	httpClient, err := http_client.NewClient(options.baseURL)
 	if err != nil {
@@ -48,11 +254,135 @@ func NewClient(apiKey string, opts ...Option) (*Client, error) {
 	httpClient.SetHeader("Accept", "application/json")
 	httpClient.SetHeader("Content-type", "application/json")
 	httpClient.SetBearer(apiKey)
+	if options.httpClient != nil {
+		httpClient.SetHTTPClient(options.httpClient)
+	}
+	if options.keyPool != nil {
+		pooled := http.Client{}
+		if options.httpClient != nil {
+			pooled = *options.httpClient
+		}
+		pooled.Transport = options.keyPool.Transport(pooled.Transport)
+		httpClient.SetHTTPClient(&pooled)
+	}
+	if options.logger != nil {
+		httpClient.SetLogger(options.logger)
+	}
+	var breaker *CircuitBreaker
+	if options.breaker != nil {
+		config := *options.breaker
+		if logger := options.logger; logger != nil {
+			onStateChange := config.OnStateChange
+			config.OnStateChange = func(scope CircuitScope, from, to CircuitState) {
+				logger.Warn("circuit state changed", "scope", scope.String(), "from", from.String(), "to", to.String())
+				if onStateChange != nil {
+					onStateChange(scope, from, to)
+				}
+			}
+		}
+		breaker = http_client.NewCircuitBreaker(config)
+		httpClient.SetCircuitBreaker(breaker)
+	}
+
+	balances := &BalancesClient{httpClient}
+	var balanceGuard *BalanceGuard
+	if options.balanceGuard != nil {
+		balanceGuard = NewBalanceGuard(balances, *options.balanceGuard)
+		balanceGuard.Start()
+	}
+
+	models := &ModelsClient{httpClient}
+	var modelCatalog *ModelCatalog
+	if options.modelCatalog != nil {
+		modelCatalog = NewModelCatalog(models, *options.modelCatalog)
+	}
+
+	var rateLimiter *RateLimiter
+	if options.rateLimit != nil {
+		rateLimiter = NewRateLimiter(*options.rateLimit)
+	}
+
+	var singleflight *Singleflight
+	if options.singleflight {
+		singleflight = NewSingleflight()
+	}
+
+	var hedger *Hedger
+	if options.hedge != nil {
+		hedger = NewHedger(*options.hedge)
+	}
+
+	// Identical requests are collapsed first, so that a shared request is logged and measured once, then rejected
+	// before being hedged and rate limited, and only the requests sent are recorded.
+	chain := options.middlewares
+	if singleflight != nil {
+		chain = chain.Append(singleflight.Middleware())
+	}
+	if options.logger != nil {
+		chain = chain.Append(chatLogger{logger: options.logger, content: options.logContent, maxContentLength: options.maxContent}.middleware())
+	}
+	if options.metrics != nil {
+		chain = chain.Append(MetricsMiddleware(options.metrics))
+	}
+	if balanceGuard != nil {
+		chain = chain.Append(balanceGuard.Middleware())
+	}
+	if modelCatalog != nil && options.modelCatalog.RejectUnknown {
+		chain = chain.Append(modelCatalog.Middleware())
+	}
+	if hedger != nil {
+		chain = chain.Append(hedger.Middleware())
+	}
+	if rateLimiter != nil {
+		chain = chain.Append(rateLimiter.Middleware())
+	}
+	if options.ledger != nil {
+		chain = chain.Append(options.ledger.Middleware())
+	}
+	if options.keyPool != nil {
+		// Outside the fallback, the usage is counted for the key of the target which served the completion.
+		chain = chain.Append(options.keyPool.Middleware())
+	}
+	if options.fallback != nil {
+		// The fallback is the innermost middleware, so the others see a single request whichever target serves it.
+		policy := *options.fallback
+		policy.Targets = slices.Clone(policy.Targets)
+		if logger := options.logger; logger != nil {
+			onFallback := policy.OnFallback
+			policy.OnFallback = func(from, to string, err error) {
+				logger.Warn("chat completion falling back", "from", from, "to", to, "error", err)
+				if onFallback != nil {
+					onFallback(from, to, err)
+				}
+			}
+		}
+		for i, target := range policy.Targets {
+			if target.Chats == nil && target.BaseURL != "" {
+				policy.Targets[i].Chats = &ChatsClient{httpClient.Clone(target.BaseURL)}
+			}
+		}
+		chain = chain.Append(policy.Middleware())
+	}
 
 	return &Client{
-		BaseURL: options.baseURL,
-		Balance: &BalancesClient{httpClient},
-		Chats:   &ChatsClient{httpClient},
-		Models:  &ModelsClient{httpClient},
+		BaseURL:        options.baseURL,
+		Balance:        balances,
+		Chats:          chain.Then(&ChatsClient{httpClient}),
+		Models:         models,
+		CircuitBreaker: breaker,
+		BalanceGuard:   balanceGuard,
+		ModelCatalog:   modelCatalog,
+		RateLimiter:    rateLimiter,
+		Singleflight:   singleflight,
+		Hedger:         hedger,
 	}, nil
 }
+
+// Close stops the background work of the client, i.e. the polling of its BalanceGuard. The client can still be used
+// afterwards.
+func (c *Client) Close() error {
+	if c.BalanceGuard != nil {
+		return c.BalanceGuard.Close()
+	}
+	return nil
+}
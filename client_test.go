@@ -35,6 +35,20 @@ func TestNewClient(t *testing.T) {
 			expectedBaseURL: "",
 			wantErr:         true,
 		},
+		{
+			name:            "Rate limit",
+			apiKey:          "api-key",
+			opts:            []deepseek.Option{deepseek.WithRateLimit(deepseek.RateLimitConfig{RequestsPerMinute: 60})},
+			expectedBaseURL: deepseek.DefaultBaseURL,
+			wantErr:         false,
+		},
+		{
+			name:            "Negative rate limit",
+			apiKey:          "api-key",
+			opts:            []deepseek.Option{deepseek.WithRateLimit(deepseek.RateLimitConfig{TokensPerMinute: -1})},
+			expectedBaseURL: "",
+			wantErr:         true,
+		},
 	}
 
 	for _, testCase := range testCases {
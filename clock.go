@@ -0,0 +1,20 @@
+package deepseek
+
+import "time"
+
+// Clock tells the time to the schedulers of the package, so that they can be tested without waiting.
+type Clock interface {
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
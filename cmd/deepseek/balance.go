@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/roushou/deepseek"
+)
+
+const balanceUsage = `Usage: deepseek balance [show|snapshot|watch|forecast] [flags]
+
+Subcommands:
+  show       Print the current balance (default)
+  snapshot   Append the current balance to the history file
+  watch      Append the balance to the history file at a regular interval
+  forecast   Print the burn rate and projected depletion of the balance
+`
+
+func runBalance(args []string) error {
+	subcommand := "show"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		subcommand, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet("balance "+subcommand, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), balanceUsage)
+		flags.PrintDefaults()
+	}
+	historyPath := flags.String("history", "balances.jsonl", "path of the balance history file")
+	interval := flags.Duration("interval", 15*time.Minute, "snapshot interval of watch")
+	currency := flags.String("currency", "USD", "currency of the forecast")
+	window := flags.Duration("window", 24*time.Hour, "burn rate window of the forecast")
+	ledgerPath := flags.String("ledger", "", "path of a JSONL usage ledger to cross-check the forecast with")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	history := deepseek.NewBalanceHistory(*historyPath)
+	switch subcommand {
+	case "show":
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		balance, err := client.Balance.GetUserBalance()
+		if err != nil {
+			return err
+		}
+		printBalance(balance)
+		return nil
+	case "snapshot":
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		snapshot, err := history.Snapshot(client.Balance)
+		if err != nil {
+			return err
+		}
+		printSnapshot(snapshot)
+		return nil
+	case "watch":
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		history.OnError = func(err error) {
+			fmt.Fprintf(os.Stderr, "snapshot failed: %v\n", err)
+		}
+		history.Run(ctx, client.Balance, *interval)
+		return nil
+	case "forecast":
+		return printForecast(history, *currency, *window, *ledgerPath)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown balance subcommand %q", subcommand)
+	}
+}
+
+func printBalance(balance *deepseek.UserBalanceResponse) {
+	fmt.Printf("Available: %t\n", balance.IsAvailable)
+	for _, info := range balance.BalanceInfos {
+		fmt.Printf("%s total: %s (granted: %s, topped up: %s)\n", info.Currency, info.TotalBalance, info.GrantedBalance, info.ToppedUpBalance)
+	}
+}
+
+func printSnapshot(snapshot deepseek.BalanceSnapshot) {
+	fmt.Printf("Time: %s\n", snapshot.Time.Format(time.RFC3339))
+	fmt.Printf("Available: %t\n", snapshot.IsAvailable)
+	for _, balance := range snapshot.Balances {
+		fmt.Printf("%s total: %s (granted: %s, topped up: %s)\n", balance.Currency, balance.Total, balance.Granted, balance.ToppedUp)
+	}
+}
+
+func printForecast(history *deepseek.BalanceHistory, currency string, window time.Duration, ledgerPath string) error {
+	now := time.Now()
+	forecast, err := history.Forecast(currency, window, now)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Window: %s to %s\n", forecast.Since.Format(time.RFC3339), forecast.Until.Format(time.RFC3339))
+	fmt.Printf("Balance: %s %s\n", forecast.Balance, currency)
+	fmt.Printf("Spent: %s %s (granted: %s, topped up: %s)\n", forecast.Spent, currency, forecast.SpentGranted, forecast.SpentToppedUp)
+	fmt.Printf("Topped up: %s %s\n", forecast.ToppedUp, currency)
+	fmt.Printf("Burn rate: %.4f %s/hour\n", forecast.PerHour, currency)
+	if forecast.DepletesAt.IsZero() {
+		fmt.Println("Depletes: never at the current rate")
+	} else {
+		fmt.Printf("Depletes: %s (in %s)\n", forecast.DepletesAt.Format(time.RFC3339), forecast.DepletesAt.Sub(now).Round(time.Minute))
+	}
+
+	if ledgerPath == "" {
+		return nil
+	}
+	sink, err := deepseek.OpenJSONLSink(ledgerPath)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer sink.Close()
+
+	check, err := history.CrossCheck(deepseek.NewLedger(sink), currency, window, now)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Ledger cost: %.4f %s (unaccounted spend: %.4f %s)\n", check.LedgerCost, currency, check.Difference, currency)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/roushou/deepseek"
+)
+
+const batchUsage = `Usage: deepseek batch [flags] <input.jsonl>
+
+Runs the completion requests of a JSONL file whose lines are {"custom_id": "...", "body": {...}} objects, and appends
+the results to a JSONL output file. Requests already completed in the output file are skipped, so an interrupted batch
+can be resumed by running the same command again.
+
+Flags:
+`
+
+func runBatch(args []string) error {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), batchUsage)
+		flags.PrintDefaults()
+	}
+	outputPath := flags.String("output", "", "path of the results file (default <input>.results.jsonl)")
+	concurrency := flags.Int("concurrency", 4, "maximum number of requests in flight")
+	rpm := flags.Int("rpm", 0, "maximum number of requests per minute, 0 for no limit")
+	retries := flags.Int("retries", 3, "number of retries of failed requests")
+	quiet := flags.Bool("quiet", false, "don't print the progress")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("missing input file")
+	}
+	inputPath := flags.Arg(0)
+	if *outputPath == "" {
+		*outputPath = strings.TrimSuffix(inputPath, ".jsonl") + ".results.jsonl"
+	}
+	if *retries == 0 {
+		*retries = -1
+	}
+
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	config := deepseek.BatchConfig{
+		Concurrency:       *concurrency,
+		RequestsPerMinute: *rpm,
+		MaxRetries:        *retries,
+	}
+	if !*quiet {
+		config.OnResult = func(result deepseek.BatchResult) {
+			if result.Error != "" {
+				fmt.Fprintf(os.Stderr, "%s: failed after %d attempts: %s\n", result.CustomID, result.Attempts, result.Error)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: done in %s\n", result.CustomID, result.Latency.Round(time.Millisecond))
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	summary, err := deepseek.NewBatchRunner(client.Chats, config).RunFile(ctx, inputPath, *outputPath)
+	printBatchSummary(summary, *outputPath)
+	if errors.Is(err, context.Canceled) {
+		return errors.New("interrupted, run the same command again to resume")
+	}
+	return err
+}
+
+func printBatchSummary(summary deepseek.BatchSummary, outputPath string) {
+	fmt.Printf("Requests: %d (skipped: %d, succeeded: %d, failed: %d, retries: %d)\n",
+		summary.Requests, summary.Skipped, summary.Succeeded, summary.Failed, summary.Retries)
+	fmt.Printf("Duration: %s\n", summary.Duration.Round(time.Millisecond))
+	fmt.Printf("Tokens: %d (prompt: %d, cache hit: %d, completion: %d)\n",
+		summary.Usage.TotalTokens, summary.Usage.PromptTokens, summary.Usage.PromptCacheHitTokens, summary.Usage.CompletionTokens)
+	fmt.Printf("Cost: %.4f USD / %.4f CNY\n", summary.Usage.Cost.USD, summary.Usage.Cost.CNY)
+	fmt.Printf("Results: %s\n", outputPath)
+}
@@ -0,0 +1,57 @@
+// Command deepseek is a command line interface to the DeepSeek API.
+//
+// The API key is read from the DEEPSEEK_API_KEY environment variable.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/roushou/deepseek"
+)
+
+const usage = `Usage: deepseek <command> [arguments]
+
+Commands:
+  balance    Show, record and forecast the account balance
+  batch      Run the completion requests of a JSONL file
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "balance":
+		err = runBalance(os.Args[2:])
+	case "batch":
+		err = runBatch(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "deepseek: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func newClient() (*deepseek.Client, error) {
+	apiKey := os.Getenv("DEEPSEEK_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("DEEPSEEK_API_KEY is not set")
+	}
+
+	var opts []deepseek.Option
+	if baseURL := os.Getenv("DEEPSEEK_BASE_URL"); baseURL != "" {
+		opts = append(opts, deepseek.WithBaseURL(baseURL))
+	}
+	return deepseek.NewClient(apiKey, opts...)
+}
@@ -0,0 +1,106 @@
+package deepseek
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimal is an exact decimal number, such as a balance amount. The zero value is 0.
+type Decimal struct {
+	rat *big.Rat
+	// scale is the number of digits after the decimal point used to format the number.
+	scale int
+}
+
+// ParseDecimal parses a decimal number such as "110.00".
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if strings.ContainsAny(s, "eE/") {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	rat, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	var scale int
+	if _, fraction, ok := strings.Cut(s, "."); ok {
+		scale = len(fraction)
+	}
+	return Decimal{rat: rat, scale: scale}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics if the number can't be parsed.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) value() *big.Rat {
+	if d.rat == nil {
+		return new(big.Rat)
+	}
+	return d.rat
+}
+
+// Add returns d + other.
+func (d Decimal) Add(other Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Add(d.value(), other.value()), scale: max(d.scale, other.scale)}
+}
+
+// Sub returns d - other.
+func (d Decimal) Sub(other Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Sub(d.value(), other.value()), scale: max(d.scale, other.scale)}
+}
+
+// Cmp compares d and other and returns -1, 0 or +1.
+func (d Decimal) Cmp(other Decimal) int {
+	return d.value().Cmp(other.value())
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of d.
+func (d Decimal) Sign() int {
+	return d.value().Sign()
+}
+
+// IsZero reports whether d is 0.
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Float64 returns the nearest float64 value of d.
+func (d Decimal) Float64() float64 {
+	f, _ := d.value().Float64()
+	return f
+}
+
+func (d Decimal) String() string {
+	return d.value().FloatString(d.scale)
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		// Also accept numbers.
+		s = string(data)
+	}
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,15 @@
+package deepseek
+
+import "github.com/roushou/deepseek/internal/http_client"
+
+// Errors returned by the API, to be checked with errors.Is.
+var (
+	ErrInvalidFormat        = http_client.ErrInvalidFormat
+	ErrAuthenticationFailed = http_client.ErrAuthenticationFailed
+	ErrInsufficientBalance  = http_client.ErrInsufficientBalance
+	ErrNotFound             = http_client.ErrNotFound
+	ErrInvalidParameters    = http_client.ErrInvalidParameters
+	ErrRateLimitExceeded    = http_client.ErrRateLimitExceeded
+	ErrServer               = http_client.ErrServer
+	ErrServiceUnavailable   = http_client.ErrServiceUnavailable
+)
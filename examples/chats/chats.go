@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -14,7 +15,7 @@ func main() {
 		log.Fatalf("failed to create client: %v", err)
 	}
 
-	completion, err := client.Chats.CreateCompletion(deepseek.CompletionArgs{
+	completion, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
 		Model: deepseek.DeepSeekChat,
 		Messages: []deepseek.Message{
 			{
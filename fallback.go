@@ -0,0 +1,194 @@
+package deepseek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// ErrInsufficientSystemResource is the error of a completion interrupted with the insufficient_system_resource finish
+// reason, which a FallbackPolicy retries on its next target.
+var ErrInsufficientSystemResource = errors.New("insufficient system resource")
+
+// FallbackTarget is a hop of a FallbackPolicy.
+type FallbackTarget struct {
+	// Name identifies the target in the ServedBy field of responses. Defaults to the model and base URL of the target.
+	Name string
+
+	// BaseURL sends the requests of the target to another endpoint, with the credentials and HTTP client of the client
+	// configured WithFallback. Empty means the endpoint of the client.
+	BaseURL string
+
+	// Chats sends the requests of the target instead of the wrapped service, e.g. a client of another provider. It
+	// takes precedence over BaseURL.
+	Chats ChatService
+
+	// Model replaces the model of the requests when not empty.
+	Model ModelID
+
+	// Transform adjusts the parameters of the requests for the target, e.g. removing the ones its model doesn't support.
+	Transform func(args CompletionArgs) CompletionArgs
+}
+
+// name returns the name of the target.
+func (t FallbackTarget) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	name := string(t.Model)
+	if t.BaseURL != "" {
+		name += "@" + t.BaseURL
+	}
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+func (t FallbackTarget) apply(args CompletionArgs) CompletionArgs {
+	if t.Model != "" {
+		args.Model = t.Model
+	}
+	if t.Transform != nil {
+		args = t.Transform(args)
+	}
+	return args
+}
+
+// FallbackPolicy sends a request to its targets in order until one succeeds, see WithFallback.
+//
+// The first target is usually the request unchanged, i.e. FallbackTarget{Name: "primary"}. A streaming completion
+// falls back only when its stream fails before delivering its first chunk.
+type FallbackPolicy struct {
+	Targets []FallbackTarget
+
+	// ShouldFallback reports whether an error is retried on the next target. Defaults to IsFallbackError.
+	ShouldFallback func(err error) bool
+
+	// OnFallback is called when a target failed and the request is sent to the next one.
+	OnFallback func(from, to string, err error)
+}
+
+// IsFallbackError reports whether err means the model or endpoint is unavailable: server errors, timeouts, open
+// circuits and completions interrupted for lack of resources.
+func IsFallbackError(err error) bool {
+	if errors.Is(err, ErrServiceUnavailable) || errors.Is(err, ErrServer) || errors.Is(err, ErrInsufficientSystemResource) {
+		return true
+	}
+	var open *ErrCircuitOpen
+	if errors.As(err, &open) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Middleware returns a middleware applying the policy. Targets without Chats are sent to the wrapped service, so
+// targets with a BaseURL require WithFallback to be resolved.
+func (p FallbackPolicy) Middleware() ChatMiddleware {
+	shouldFallback := p.ShouldFallback
+	if shouldFallback == nil {
+		shouldFallback = IsFallbackError
+	}
+
+	return func(next ChatService) ChatService {
+		service := func(target FallbackTarget) (ChatService, error) {
+			switch {
+			case target.Chats != nil:
+				return target.Chats, nil
+			case target.BaseURL != "":
+				return nil, fmt.Errorf("fallback target %s: base URL requires WithFallback", target.name())
+			default:
+				return next, nil
+			}
+		}
+		fallback := func(i int, err error) bool {
+			if i == len(p.Targets)-1 || !shouldFallback(err) {
+				return false
+			}
+			if p.OnFallback != nil {
+				p.OnFallback(p.Targets[i].name(), p.Targets[i+1].name(), err)
+			}
+			return true
+		}
+
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				if len(p.Targets) == 0 {
+					return next.CreateCompletion(ctx, args)
+				}
+				for i, target := range p.Targets {
+					chats, err := service(target)
+					if err != nil {
+						return nil, err
+					}
+					completion, err := chats.CreateCompletion(ctx, target.apply(args))
+					if err == nil {
+						completion.ServedBy = target.name()
+						if !interrupted(completion) {
+							return completion, nil
+						}
+						err = fmt.Errorf("%w: completion interrupted by %s", ErrInsufficientSystemResource, target.name())
+					}
+					if ctx.Err() != nil || !fallback(i, err) {
+						// The interrupted completion of the last target is still better than nothing.
+						return completion, errIfNil(completion, err)
+					}
+				}
+				panic("unreachable")
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				if len(p.Targets) == 0 {
+					return next.CreateStreamCompletion(ctx, args)
+				}
+				for i, target := range p.Targets {
+					chats, err := service(target)
+					if err != nil {
+						return ssestream.NewStream[StreamCompletionChunk](nil, err)
+					}
+					stream := chats.CreateStreamCompletion(ctx, target.apply(args.completionArgs()).streamArgs(args.StreamOptions))
+					if stream.Peek() || ctx.Err() != nil || !fallback(i, stream.Err()) {
+						name := target.name()
+						stream.Transform(func(chunk StreamCompletionChunk) StreamCompletionChunk {
+							chunk.ServedBy = name
+							return chunk
+						})
+						return stream
+					}
+					stream.Close()
+				}
+				panic("unreachable")
+			},
+		}
+	}
+}
+
+// servedModel returns the model which served a completion, which differs from the model requested after a fallback.
+func servedModel(requested, served ModelID) ModelID {
+	if served != "" {
+		return served
+	}
+	return requested
+}
+
+// interrupted reports whether a choice of the completion was interrupted for lack of resources.
+func interrupted(completion *CompletionResponse) bool {
+	for _, choice := range completion.Choices {
+		if choice.FinishReason == CompletionFinishReasonInsufficientSystemResource {
+			return true
+		}
+	}
+	return false
+}
+
+// errIfNil returns err only when there is no completion to return instead.
+func errIfNil(completion *CompletionResponse, err error) error {
+	if completion != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func TestFallback(t *testing.T) {
+	primary := deepseektest.NewServer(t)
+	secondary := deepseektest.NewServer(t)
+	primary.Enqueue(deepseektest.Error(http.StatusServiceUnavailable, "overloaded").ExpectModel(deepseek.DeepSeekReasoner))
+	secondary.Enqueue(deepseektest.Text(deepseek.DeepSeekChat, "Hello!").ExpectModel(deepseek.DeepSeekChat))
+
+	var hops []string
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(primary.URL), deepseek.WithFallback(deepseek.FallbackPolicy{
+		Targets: []deepseek.FallbackTarget{
+			{Name: "primary"},
+			{BaseURL: secondary.URL, Model: deepseek.DeepSeekChat},
+		},
+		OnFallback: func(from, to string, err error) { hops = append(hops, from+" -> "+to) },
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completion, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekReasoner,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := string(deepseek.DeepSeekChat) + "@" + secondary.URL; completion.ServedBy != want {
+		t.Errorf("ServedBy = %q; want %q", completion.ServedBy, want)
+	}
+	if len(hops) != 1 || hops[0] != "primary -> "+completion.ServedBy {
+		t.Errorf("hops = %v", hops)
+	}
+	primary.AssertDrained()
+	secondary.AssertDrained()
+}
+
+func TestFallbackInterrupted(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	interrupted := deepseek.CompletionResponse{Model: deepseek.DeepSeekReasoner, Choices: []deepseek.CompletionChoice{{
+		Message:      deepseek.Message{Role: deepseek.AssistantRole, Content: "Hel"},
+		FinishReason: deepseek.CompletionFinishReasonInsufficientSystemResource,
+	}}}
+	server.Enqueue(deepseektest.Completion(interrupted), deepseektest.Completion(interrupted))
+
+	policy := deepseek.FallbackPolicy{Targets: []deepseek.FallbackTarget{{Name: "reasoner"}, {Name: "chat", Model: deepseek.DeepSeekChat}}}
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithFallback(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last target has no fallback, so its interrupted completion is returned as is.
+	completion, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekReasoner,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completion.ServedBy != "chat" || completion.Choices[0].Message.Content != "Hel" {
+		t.Errorf("completion = %+v", completion)
+	}
+	server.AssertDrained()
+}
+
+func TestFallbackNotRetried(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(deepseektest.Error(http.StatusBadRequest, "invalid"))
+
+	policy := deepseek.FallbackPolicy{Targets: []deepseek.FallbackTarget{{}, {Model: deepseek.DeepSeekChat}}}
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithFallback(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekReasoner,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	if !errors.Is(err, deepseek.ErrInvalidFormat) {
+		t.Fatalf("error = %v; want ErrInvalidFormat", err)
+	}
+	server.AssertRequestCount(1)
+}
+
+func TestFallbackStream(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(
+		deepseektest.Error(http.StatusServiceUnavailable, "overloaded"),
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello there!").ExpectModel(deepseek.DeepSeekChat),
+	)
+
+	policy := deepseek.FallbackPolicy{Targets: []deepseek.FallbackTarget{
+		{Name: "reasoner"},
+		{Name: "chat", Model: deepseek.DeepSeekChat},
+	}}
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithFallback(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{
+		Model:    deepseek.DeepSeekReasoner,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	defer stream.Close()
+
+	var acc deepseek.StreamAccumulator
+	for stream.Next() {
+		chunk := stream.Current()
+		if chunk.ServedBy != "chat" {
+			t.Errorf("ServedBy = %q; want chat", chunk.ServedBy)
+		}
+		acc.Add(chunk)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if content := acc.Response().Choices[0].Message.Content; content != "Hello there!" {
+		t.Errorf("content = %q", content)
+	}
+	server.AssertDrained()
+}
+
+func TestFallbackLedger(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(
+		deepseektest.Error(http.StatusServiceUnavailable, "overloaded").ExpectModel(deepseek.DeepSeekReasoner),
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello!").ExpectModel(deepseek.DeepSeekChat),
+	)
+
+	ledger := deepseek.NewLedger(deepseek.NewMemorySink())
+	policy := deepseek.FallbackPolicy{Targets: []deepseek.FallbackTarget{{Name: "reasoner"}, {Name: "chat", Model: deepseek.DeepSeekChat}}}
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithLedger(ledger), deepseek.WithFallback(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completion, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekReasoner,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The completion is priced as served by the chat model, not as requested from the reasoner.
+	records, err := ledger.Records(deepseek.LedgerQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("records = %+v; want 1", records)
+	}
+	if records[0].Model != deepseek.DeepSeekChat {
+		t.Errorf("Model = %q; want %q", records[0].Model, deepseek.DeepSeekChat)
+	}
+	if want := deepseek.Cost(completion.Usage, deepseek.DeepSeekChat, records[0].Time); records[0].Cost != want {
+		t.Errorf("Cost = %+v; want %+v", records[0].Cost, want)
+	}
+}
@@ -0,0 +1,250 @@
+package deepseek
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// HedgeConfig configures a Hedger.
+type HedgeConfig struct {
+	// Delay is how long the first byte of a response, or the first chunk of a stream, is awaited before sending a
+	// duplicate request. Defaults to 2 seconds.
+	Delay time.Duration
+
+	// MaxHedgeRatio is the maximum fraction of the requests that are hedged. Defaults to 0.1.
+	MaxHedgeRatio float64
+
+	// Budget is the maximum extra spend in USD, see HedgeStats.ExtraCost. No request is hedged once it is reached. Zero
+	// means no budget.
+	Budget float64
+
+	// Clock defaults to SystemClock.
+	Clock Clock
+}
+
+// HedgeStats are statistics of a Hedger.
+type HedgeStats struct {
+	// Requests is the number of requests.
+	Requests int64
+
+	// Hedged is the number of requests for which a duplicate request was sent.
+	Hedged int64
+
+	// HedgeWins is the number of hedged requests answered by the duplicate request.
+	HedgeWins int64
+
+	// Capped is the number of slow requests that weren't hedged because of MaxHedgeRatio or Budget.
+	Capped int64
+
+	// ExtraCost is the estimated cost of the duplicate requests. Each hedged request is counted with the cost of its
+	// completion, an upper bound since the request losing the race is cancelled before completing.
+	ExtraCost Amount
+}
+
+// HedgeRate returns the fraction of the requests that were hedged.
+func (s HedgeStats) HedgeRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Hedged) / float64(s.Requests)
+}
+
+// Hedger cuts the tail latency of completions by sending a duplicate of the requests that are slow to answer and
+// using whichever answers first, see WithHedging. The other request is cancelled.
+type Hedger struct {
+	config HedgeConfig
+
+	mu    sync.Mutex
+	stats HedgeStats
+}
+
+// NewHedger creates a hedger.
+func NewHedger(config HedgeConfig) *Hedger {
+	if config.Delay <= 0 {
+		config.Delay = 2 * time.Second
+	}
+	if config.MaxHedgeRatio <= 0 {
+		config.MaxHedgeRatio = 0.1
+	}
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+	return &Hedger{config: config}
+}
+
+// Stats returns the statistics of the hedger.
+func (h *Hedger) Stats() HedgeStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// Middleware returns a middleware hedging the completions.
+func (h *Hedger) Middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				return h.complete(ctx, next, args)
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				return h.stream(ctx, next, args)
+			},
+		}
+	}
+}
+
+type hedgeAttempt[T any] struct {
+	result T
+	err    error
+	hedge  bool
+}
+
+func (h *Hedger) complete(ctx context.Context, next ChatService, args CompletionArgs) (*CompletionResponse, error) {
+	h.count()
+
+	// Both requests are cancelled once one of them answered.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeAttempt[*CompletionResponse], 2)
+	start := func(ctx context.Context, hedge bool) {
+		go func() {
+			completion, err := next.CreateCompletion(ctx, args)
+			results <- hedgeAttempt[*CompletionResponse]{result: completion, err: err, hedge: hedge}
+		}()
+	}
+
+	// The request isn't hedged once the API started answering it.
+	firstByte := make(chan struct{})
+	var once sync.Once
+	start(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { once.Do(func() { close(firstByte) }) },
+	}), false)
+
+	pending, hedged := 1, false
+	select {
+	case <-firstByte:
+	case attempt := <-results:
+		return attempt.result, attempt.err
+	case <-h.config.Clock.After(h.config.Delay):
+		if h.hedge() {
+			start(ctx, true)
+			pending, hedged = 2, true
+		}
+	}
+
+	// The first success wins, an error only when both requests failed.
+	var attempt hedgeAttempt[*CompletionResponse]
+	for ; pending > 0; pending-- {
+		attempt = <-results
+		if attempt.err == nil {
+			break
+		}
+	}
+	if attempt.err == nil && hedged {
+		h.settle(attempt.hedge, attempt.result.Cost())
+	}
+	return attempt.result, attempt.err
+}
+
+func (h *Hedger) stream(ctx context.Context, next ChatService, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+	h.count()
+
+	// The streams are peeked in the background so that the first one delivering a chunk wins. Each has its own context
+	// so that the loser can be cancelled while the winner is read.
+	type peeked = hedgeAttempt[*ssestream.Stream[StreamCompletionChunk]]
+	results := make(chan peeked, 2)
+	cancels := make(map[bool]context.CancelFunc, 2)
+	start := func(hedge bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancels[hedge] = cancel
+		go func() {
+			stream := next.CreateStreamCompletion(ctx, args)
+			stream.Peek()
+			results <- peeked{result: stream, err: stream.Err(), hedge: hedge}
+		}()
+	}
+	start(false)
+
+	pending, hedged := 1, false
+	select {
+	case attempt := <-results:
+		return h.settleStream(args, attempt, cancels[false], false)
+	case <-h.config.Clock.After(h.config.Delay):
+		if h.hedge() {
+			start(true)
+			pending, hedged = 2, true
+		}
+	}
+
+	var attempt peeked
+	for ; pending > 0; pending-- {
+		attempt = <-results
+		if attempt.err == nil || pending == 1 {
+			break
+		}
+		cancels[attempt.hedge]()
+		attempt.result.Close()
+	}
+	if pending > 1 {
+		cancels[!attempt.hedge]()
+		go func() {
+			loser := <-results
+			loser.result.Close()
+		}()
+	}
+	return h.settleStream(args, attempt, cancels[attempt.hedge], hedged)
+}
+
+// settleStream returns the stream winning the race, releasing its context and accounting for it once it's done.
+func (h *Hedger) settleStream(args StreamCompletionArgs, attempt hedgeAttempt[*ssestream.Stream[StreamCompletionChunk]], cancel context.CancelFunc, hedged bool) *ssestream.Stream[StreamCompletionChunk] {
+	var acc StreamAccumulator
+	attempt.result.OnChunk(acc.Add)
+	attempt.result.OnDone(func(err error) {
+		cancel()
+		if !hedged {
+			return
+		}
+		usage, ok := acc.Usage()
+		if !ok {
+			usage = estimateStreamUsage(args, &acc)
+		}
+		h.settle(attempt.hedge, Cost(usage, args.Model, h.config.Clock.Now()))
+	})
+	return attempt.result
+}
+
+func (h *Hedger) count() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stats.Requests++
+}
+
+// hedge reports whether a slow request can be hedged within the caps, and counts it.
+func (h *Hedger) hedge() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	withinRatio := float64(h.stats.Hedged+1) <= h.config.MaxHedgeRatio*float64(h.stats.Requests)
+	withinBudget := h.config.Budget <= 0 || h.stats.ExtraCost.USD < h.config.Budget
+	if !withinRatio || !withinBudget {
+		h.stats.Capped++
+		return false
+	}
+	h.stats.Hedged++
+	return true
+}
+
+// settle accounts for the completion of a hedged request.
+func (h *Hedger) settle(won bool, cost Amount) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if won {
+		h.stats.HedgeWins++
+	}
+	h.stats.ExtraCost = h.stats.ExtraCost.Add(cost)
+}
@@ -0,0 +1,186 @@
+package deepseek_test
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+func TestHedging(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(
+		deepseektest.Text(deepseek.DeepSeekChat, "Slow").WithDelay(10*time.Second),
+		deepseektest.Text(deepseek.DeepSeekChat, "Fast"),
+	)
+
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithHedging(deepseek.HedgeConfig{
+		Delay:         time.Second,
+		MaxHedgeRatio: 1,
+		Clock:         clock,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	type result struct {
+		completion *deepseek.CompletionResponse
+		err        error
+	}
+	done := make(chan result)
+	go func() {
+		completion, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+			Model:    deepseek.DeepSeekChat,
+			Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+		})
+		done <- result{completion, err}
+	}()
+	// The hedge is sent once the first request got the slow response.
+	clock.BlockUntil(1)
+	for server.Pending() > 1 {
+		runtime.Gosched()
+	}
+	clock.Advance(time.Second)
+	r := <-done
+	completion, err := r.completion, r.err
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := completion.Choices[0].Message.Content; content != "Fast" {
+		t.Errorf("content = %q; want the hedge", content)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("completion took %s; the slow request wasn't hedged", elapsed)
+	}
+
+	stats := client.Hedger.Stats()
+	if stats.Requests != 1 || stats.Hedged != 1 || stats.HedgeWins != 1 || stats.HedgeRate() != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if stats.ExtraCost.USD <= 0 {
+		t.Errorf("extra cost = %v; want the cost of the hedge", stats.ExtraCost)
+	}
+	server.AssertDrained()
+}
+
+func TestHedgingFastResponse(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(deepseektest.Text(deepseek.DeepSeekChat, "Hello!"))
+
+	// The clock never reaches the delay, the response always comes first.
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithHedging(deepseek.HedgeConfig{
+		Delay:         time.Second,
+		MaxHedgeRatio: 1,
+		Clock:         deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.Hedger.Stats(); stats.Hedged != 0 || stats.ExtraCost.USD != 0 {
+		t.Errorf("stats = %+v; want no hedge", stats)
+	}
+	server.AssertRequestCount(1)
+}
+
+func TestHedgingCapped(t *testing.T) {
+	// A single request is below the default ratio of one hedge every ten requests.
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	hedger := deepseek.NewHedger(deepseek.HedgeConfig{Delay: time.Second, Clock: clock})
+
+	// The request answers once the hedge was considered.
+	var requests atomic.Int32
+	answer := make(chan struct{})
+	chats := hedger.Middleware()(deepseek.ChatFuncs{
+		CompleteFunc: func(ctx context.Context, args deepseek.CompletionArgs) (*deepseek.CompletionResponse, error) {
+			requests.Add(1)
+			<-answer
+			return &deepseek.CompletionResponse{Model: args.Model}, nil
+		},
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat})
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	for hedger.Stats().Capped == 0 {
+		runtime.Gosched()
+	}
+	close(answer)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if stats := hedger.Stats(); stats.Hedged != 0 || stats.Capped != 1 {
+		t.Errorf("stats = %+v; want a capped hedge", stats)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests = %d; want 1", got)
+	}
+}
+
+func TestHedgingStream(t *testing.T) {
+	slow := deepseek.CompletionResponse{Model: deepseek.DeepSeekChat, Choices: []deepseek.CompletionChoice{{
+		Message:      deepseek.Message{Role: deepseek.AssistantRole, Content: "Slow"},
+		FinishReason: deepseek.CompletionFinishReasonStop,
+	}}}
+	server := deepseektest.NewServer(t)
+	server.Enqueue(
+		deepseektest.Stream(deepseektest.StreamScript{Chunks: deepseektest.Chunks(slow), FirstChunkDelay: 10 * time.Second}),
+		deepseektest.Text(deepseek.DeepSeekChat, "Fast"),
+	)
+
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithHedging(deepseek.HedgeConfig{
+		Delay:         time.Second,
+		MaxHedgeRatio: 1,
+		Clock:         clock,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	streams := make(chan *ssestream.Stream[deepseek.StreamCompletionChunk])
+	go func() {
+		streams <- client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{
+			Model:    deepseek.DeepSeekChat,
+			Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+		})
+	}()
+	clock.BlockUntil(1)
+	for server.Pending() > 1 {
+		runtime.Gosched()
+	}
+	clock.Advance(time.Second)
+	stream := <-streams
+	var acc deepseek.StreamAccumulator
+	for stream.Next() {
+		acc.Add(stream.Current())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if content := acc.Response().Choices[0].Message.Content; content != "Fast" {
+		t.Errorf("content = %q; want the hedge", content)
+	}
+	if stats := client.Hedger.Stats(); stats.Hedged != 1 || stats.HedgeWins != 1 || stats.ExtraCost.USD <= 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	server.AssertDrained()
+}
@@ -0,0 +1,105 @@
+package deepseek
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/roushou/deepseek/internal/http_client"
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// WithRequestHeader returns a context setting a header field of the requests made with it, e.g. a request ID. The
+// fields set by ctx are kept and the headers of the client are overridden.
+func WithRequestHeader(ctx context.Context, key, value string) context.Context {
+	return http_client.WithHeader(ctx, key, value)
+}
+
+// RequestHeaderFromContext returns the header fields set by ctx.
+func RequestHeaderFromContext(ctx context.Context) http.Header {
+	return http_client.HeaderFromContext(ctx)
+}
+
+// Hooks are callbacks observing the chat completions, see WithHooks. Every callback is optional.
+//
+// Streaming completions are seen as their CompletionArgs, and their response is accumulated from their chunks.
+type Hooks struct {
+	// BeforeRequest is called before a completion is sent. It can modify the arguments, e.g. to redact messages, whose
+	// messages are a copy of the caller's. It can also return a context carrying values for the request, e.g.
+	// WithRequestHeader. An error aborts the request.
+	BeforeRequest func(ctx context.Context, args *CompletionArgs, stream bool) (context.Context, error)
+
+	// OnChunk is called with every chunk of a streaming completion before it is delivered, and can modify it. The
+	// changes are seen by the caller and the outer middlewares, but not by the inner ones, e.g. a Ledger records the
+	// chunks as received from the API.
+	OnChunk func(ctx context.Context, chunk *StreamCompletionChunk)
+
+	// AfterResponse is called once a completion is done, with its response or its error. A streaming completion is
+	// done when its stream ends, and its response is the accumulation of the chunks received, nil when none was.
+	AfterResponse func(ctx context.Context, args CompletionArgs, completion *CompletionResponse, err error)
+}
+
+// Middleware returns a middleware calling the hooks.
+func (h Hooks) Middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				if h.BeforeRequest != nil {
+					args.Messages = slices.Clone(args.Messages)
+					var err error
+					if ctx, err = h.BeforeRequest(ctx, &args, false); err != nil {
+						h.after(ctx, args, nil, err)
+						return nil, err
+					}
+				}
+				completion, err := next.CreateCompletion(ctx, args)
+				h.after(ctx, args, completion, err)
+				return completion, err
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				completionArgs := args.completionArgs()
+				if h.BeforeRequest != nil {
+					completionArgs.Messages = slices.Clone(completionArgs.Messages)
+					var err error
+					if ctx, err = h.BeforeRequest(ctx, &completionArgs, true); err != nil {
+						h.after(ctx, completionArgs, nil, err)
+						return ssestream.NewStream[StreamCompletionChunk](nil, err)
+					}
+					args = completionArgs.streamArgs(args.StreamOptions)
+				}
+
+				stream := next.CreateStreamCompletion(ctx, args)
+				if h.OnChunk != nil {
+					stream.Transform(func(chunk StreamCompletionChunk) StreamCompletionChunk {
+						h.OnChunk(ctx, &chunk)
+						return chunk
+					})
+				}
+				if h.AfterResponse != nil {
+					var acc StreamAccumulator
+					var received bool
+					stream.OnChunk(func(chunk StreamCompletionChunk) {
+						received = true
+						acc.Add(chunk)
+					})
+					stream.OnDone(func(err error) {
+						var completion *CompletionResponse
+						if received {
+							response := acc.Response()
+							completion = &response
+						}
+						h.AfterResponse(ctx, completionArgs, completion, err)
+					})
+				}
+				return stream
+			},
+		}
+	}
+}
+
+func (h Hooks) after(ctx context.Context, args CompletionArgs, completion *CompletionResponse, err error) {
+	if h.AfterResponse != nil {
+		h.AfterResponse(ctx, args, completion, err)
+	}
+}
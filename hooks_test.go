@@ -0,0 +1,142 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+func TestHooks(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(deepseektest.Text(deepseek.DeepSeekChat, "Hello!").Expect(func(req deepseektest.Request) error {
+		if id := req.Header.Get("X-Request-Id"); id != "req-1" {
+			return errors.New("missing request ID header, got " + id)
+		}
+		args, err := req.CompletionArgs()
+		if err != nil {
+			return err
+		}
+		if content := args.Messages[0].Content; content != "My card is [REDACTED]" {
+			return errors.New("message wasn't redacted: " + content)
+		}
+		return nil
+	}))
+
+	var after []string
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithHooks(deepseek.Hooks{
+		BeforeRequest: func(ctx context.Context, args *deepseek.CompletionArgs, stream bool) (context.Context, error) {
+			args.Messages[0].Content = strings.ReplaceAll(args.Messages[0].Content, "4242", "[REDACTED]")
+			return deepseek.WithRequestHeader(ctx, "X-Request-Id", "req-1"), nil
+		},
+		AfterResponse: func(ctx context.Context, args deepseek.CompletionArgs, completion *deepseek.CompletionResponse, err error) {
+			after = append(after, completion.Choices[0].Message.Content)
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []deepseek.Message{{Role: deepseek.UserRole, Content: "My card is 4242"}}
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat, Messages: messages}); err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 1 || after[0] != "Hello!" {
+		t.Errorf("after = %q", after)
+	}
+	server.AssertDrained()
+}
+
+func TestHooksAbort(t *testing.T) {
+	errBlocked := errors.New("blocked")
+	var afterErr error
+	hooks := deepseek.Hooks{
+		BeforeRequest: func(ctx context.Context, args *deepseek.CompletionArgs, stream bool) (context.Context, error) {
+			return ctx, errBlocked
+		},
+		AfterResponse: func(ctx context.Context, args deepseek.CompletionArgs, completion *deepseek.CompletionResponse, err error) {
+			afterErr = err
+		},
+	}
+	chats := hooks.Middleware()(&fakeChats{content: "Hello!"})
+
+	_, err := chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat})
+	if !errors.Is(err, errBlocked) || !errors.Is(afterErr, errBlocked) {
+		t.Errorf("error = %v, after error = %v; want blocked", err, afterErr)
+	}
+}
+
+func TestHooksStream(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(deepseektest.Text(deepseek.DeepSeekChat, "Hello there!").ExpectModel(deepseek.DeepSeekReasoner))
+
+	var streamed bool
+	var chunks int
+	var completion *deepseek.CompletionResponse
+	var inner strings.Builder
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithHooks(deepseek.Hooks{
+		BeforeRequest: func(ctx context.Context, args *deepseek.CompletionArgs, stream bool) (context.Context, error) {
+			streamed = stream
+			args.Model = deepseek.DeepSeekReasoner
+			return ctx, nil
+		},
+		OnChunk: func(ctx context.Context, chunk *deepseek.StreamCompletionChunk) {
+			chunks++
+			for i := range chunk.Choices {
+				chunk.Choices[i].Delta.Content = strings.ToUpper(chunk.Choices[i].Delta.Content)
+			}
+		},
+		AfterResponse: func(ctx context.Context, args deepseek.CompletionArgs, response *deepseek.CompletionResponse, err error) {
+			completion = response
+		},
+	}), deepseek.WithChatMiddleware(func(next deepseek.ChatService) deepseek.ChatService {
+		return deepseek.ChatFuncs{
+			Next: next,
+			StreamFunc: func(ctx context.Context, args deepseek.StreamCompletionArgs) *ssestream.Stream[deepseek.StreamCompletionChunk] {
+				stream := next.CreateStreamCompletion(ctx, args)
+				stream.OnChunk(func(chunk deepseek.StreamCompletionChunk) {
+					for _, choice := range chunk.Choices {
+						inner.WriteString(choice.Delta.Content)
+					}
+				})
+				return stream
+			},
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	var content strings.Builder
+	for stream.Next() {
+		for _, choice := range stream.Current().Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	if !streamed || chunks == 0 {
+		t.Errorf("streamed = %t, chunks = %d", streamed, chunks)
+	}
+	if content.String() != "HELLO THERE!" {
+		t.Errorf("content = %q; want the chunks modified by the hook", content.String())
+	}
+	if completion == nil || completion.Choices[0].Message.Content != "HELLO THERE!" {
+		t.Errorf("completion = %+v; want the accumulated chunks", completion)
+	}
+	if inner.String() != "Hello there!" {
+		t.Errorf("inner middleware content = %q; want the chunks as received", inner.String())
+	}
+	server.AssertDrained()
+}
@@ -0,0 +1,274 @@
+package http_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a circuit of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects requests with ErrCircuitOpen.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a few probe requests through to decide whether to close the circuit again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitScope identifies a circuit: requests to each base URL and model are tripped independently.
+type CircuitScope struct {
+	BaseURL string
+	Model   string
+}
+
+func (s CircuitScope) String() string {
+	if s.Model == "" {
+		return s.BaseURL
+	}
+	return s.BaseURL + " " + s.Model
+}
+
+// ErrCircuitOpen is returned without sending the request while the circuit of its scope is open.
+type ErrCircuitOpen struct {
+	Scope CircuitScope
+
+	// RetryAfter is the remaining time before the circuit lets a probe request through.
+	RetryAfter time.Duration
+}
+
+func (e *ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit open for %s, retry after %s", e.Scope, e.RetryAfter)
+}
+
+// CircuitBreakerConfig configures a CircuitBreaker.
+type CircuitBreakerConfig struct {
+	// FailureRatio is the ratio of failed requests over a window opening the circuit. Defaults to 0.5.
+	FailureRatio float64
+
+	// MinRequests is the number of requests of a window below which the circuit isn't opened. Defaults to 10.
+	MinRequests int
+
+	// Window is the period over which the failure ratio is measured. Defaults to 1 minute.
+	Window time.Duration
+
+	// OpenTimeout is how long the circuit stays open before letting probe requests through. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of probe requests which must succeed to close the circuit. Defaults to 1.
+	HalfOpenRequests int
+
+	// IsFailure reports whether an error counts as a failure. Defaults to IsCircuitFailure.
+	IsFailure func(err error) bool
+
+	// OnStateChange is called when the circuit of a scope changes state.
+	OnStateChange func(scope CircuitScope, from, to CircuitState)
+
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// IsCircuitFailure reports whether err means the API is failing: server errors and timeouts.
+func IsCircuitFailure(err error) bool {
+	if errors.Is(err, ErrServer) || errors.Is(err, ErrServiceUnavailable) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// CircuitBreaker fails requests fast while the API is failing, see Client.SetCircuitBreaker. It is safe for concurrent use.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mu       sync.Mutex
+	circuits map[CircuitScope]*circuit
+}
+
+type circuit struct {
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+
+	// generation is incremented by state changes, so that the requests sent in a previous state are ignored.
+	generation int
+}
+
+// NewCircuitBreaker creates a circuit breaker.
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureRatio <= 0 {
+		config.FailureRatio = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = IsCircuitFailure
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &CircuitBreaker{config: config, circuits: make(map[CircuitScope]*circuit)}
+}
+
+// State returns the state of the circuit of a scope.
+func (b *CircuitBreaker) State(scope CircuitScope) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[scope]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && b.config.Now().Sub(c.openedAt) >= b.config.OpenTimeout {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// allow reports whether a request of the scope can be sent. When it can, done must be called with its error.
+func (b *CircuitBreaker) allow(scope CircuitScope) (done func(err error), err error) {
+	b.mu.Lock()
+	now := b.config.Now()
+	c, ok := b.circuits[scope]
+	if !ok {
+		c = &circuit{windowStart: now}
+		b.circuits[scope] = c
+	}
+
+	var changed func()
+	switch c.state {
+	case CircuitOpen:
+		if elapsed := now.Sub(c.openedAt); elapsed < b.config.OpenTimeout {
+			b.mu.Unlock()
+			return nil, &ErrCircuitOpen{Scope: scope, RetryAfter: b.config.OpenTimeout - elapsed}
+		}
+		changed = b.transition(scope, c, CircuitHalfOpen, now)
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= b.config.HalfOpenRequests {
+			b.mu.Unlock()
+			b.notify(changed)
+			return nil, &ErrCircuitOpen{Scope: scope}
+		}
+		c.probes++
+	}
+	generation := c.generation
+	b.mu.Unlock()
+	b.notify(changed)
+
+	return func(err error) {
+		b.record(scope, c, generation, err)
+	}, nil
+}
+
+// record updates the circuit with the outcome of a request.
+func (b *CircuitBreaker) record(scope CircuitScope, c *circuit, generation int, err error) {
+	b.mu.Lock()
+	if c.generation != generation {
+		b.mu.Unlock()
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// Requests cancelled by the caller say nothing about the API, the probe is given to the next request.
+		if c.state == CircuitHalfOpen {
+			c.probes--
+		}
+		b.mu.Unlock()
+		return
+	}
+	failed := err != nil && b.config.IsFailure(err)
+	now := b.config.Now()
+	var changed func()
+	switch c.state {
+	case CircuitClosed:
+		if now.Sub(c.windowStart) >= b.config.Window {
+			c.windowStart, c.requests, c.failures = now, 0, 0
+		}
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= b.config.MinRequests && float64(c.failures) >= b.config.FailureRatio*float64(c.requests) {
+			changed = b.transition(scope, c, CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		switch {
+		case failed:
+			changed = b.transition(scope, c, CircuitOpen, now)
+		case c.successes+1 >= b.config.HalfOpenRequests:
+			changed = b.transition(scope, c, CircuitClosed, now)
+		default:
+			c.successes++
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changed)
+}
+
+// transition changes the state of a circuit and returns the notification of the change. The lock must be held.
+func (b *CircuitBreaker) transition(scope CircuitScope, c *circuit, to CircuitState, now time.Time) func() {
+	from := c.state
+	c.state = to
+	c.windowStart, c.requests, c.failures = now, 0, 0
+	c.probes, c.successes = 0, 0
+	c.generation++
+	if to == CircuitOpen {
+		c.openedAt = now
+	}
+	if b.config.OnStateChange == nil {
+		return nil
+	}
+	return func() { b.config.OnStateChange(scope, from, to) }
+}
+
+// notify calls the state change callback outside of the lock, so that it can use the breaker.
+func (b *CircuitBreaker) notify(changed func()) {
+	if changed != nil {
+		changed()
+	}
+}
+
+type modelKey struct{}
+
+// WithModel returns a context scoping the circuit of the requests made with it to the model.
+func WithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+func modelFromContext(ctx context.Context) string {
+	model, _ := ctx.Value(modelKey{}).(string)
+	return model
+}
@@ -0,0 +1,129 @@
+package http_client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek/internal/http_client"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var sent atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var changes []string
+	breaker := http_client.NewCircuitBreaker(http_client.CircuitBreakerConfig{
+		MinRequests: 4,
+		OpenTimeout: time.Minute,
+		Now:         func() time.Time { return now },
+		OnStateChange: func(scope http_client.CircuitScope, from, to http_client.CircuitState) {
+			changes = append(changes, scope.Model+": "+from.String()+" -> "+to.String())
+		},
+	})
+	client, _ := http_client.NewClient(server.URL)
+	client.SetCircuitBreaker(breaker)
+
+	do := func(model string) error {
+		req, err := client.NewRequestWithContext(http_client.WithModel(context.Background(), model), http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]any
+		_, err = client.Do(req, &out)
+		return err
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := do("reasoner"); !errors.Is(err, http_client.ErrServiceUnavailable) {
+			t.Fatalf("request %d error = %v; want ErrServiceUnavailable", i, err)
+		}
+	}
+	scope := http_client.CircuitScope{BaseURL: server.URL, Model: "reasoner"}
+	if state := breaker.State(scope); state != http_client.CircuitOpen {
+		t.Fatalf("state = %s; want open", state)
+	}
+
+	// The open circuit fails fast, other models aren't affected.
+	var open *http_client.ErrCircuitOpen
+	if err := do("reasoner"); !errors.As(err, &open) || open.RetryAfter != time.Minute {
+		t.Fatalf("error = %v; want ErrCircuitOpen retrying after a minute", err)
+	}
+	if sent.Load() != 4 {
+		t.Errorf("sent %d requests; want 4", sent.Load())
+	}
+	failing.Store(false)
+	if err := do("chat"); err != nil {
+		t.Fatalf("other model error = %v", err)
+	}
+
+	// A failed probe opens the circuit again, a successful one closes it.
+	failing.Store(true)
+	now = now.Add(time.Minute)
+	if err := do("reasoner"); !errors.Is(err, http_client.ErrServiceUnavailable) {
+		t.Fatalf("probe error = %v", err)
+	}
+	if err := do("reasoner"); !errors.As(err, &open) {
+		t.Fatalf("error = %v; want ErrCircuitOpen", err)
+	}
+	failing.Store(false)
+	now = now.Add(time.Minute)
+	if err := do("reasoner"); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+	if state := breaker.State(scope); state != http_client.CircuitClosed {
+		t.Errorf("state = %s; want closed", state)
+	}
+
+	want := []string{
+		"reasoner: closed -> open",
+		"reasoner: open -> half-open",
+		"reasoner: half-open -> open",
+		"reasoner: open -> half-open",
+		"reasoner: half-open -> closed",
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %q; want %q", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %q; want %q", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	breaker := http_client.NewCircuitBreaker(http_client.CircuitBreakerConfig{MinRequests: 1})
+	client, _ := http_client.NewClient(server.URL)
+	client.SetCircuitBreaker(breaker)
+
+	for i := 0; i < 3; i++ {
+		req, _ := client.NewRequest(http.MethodGet, "/", nil)
+		if _, err := client.Do(req, &struct{}{}); !errors.Is(err, http_client.ErrInvalidFormat) {
+			t.Fatalf("error = %v; want ErrInvalidFormat", err)
+		}
+	}
+	if state := breaker.State(http_client.CircuitScope{BaseURL: server.URL}); state != http_client.CircuitClosed {
+		t.Errorf("state = %s; want closed", state)
+	}
+}
@@ -6,6 +6,7 @@ var (
 	ErrInvalidFormat        = errors.New("invalid request format")
 	ErrAuthenticationFailed = errors.New("authentication failed")
 	ErrInsufficientBalance  = errors.New("insufficient balance")
+	ErrNotFound             = errors.New("not found")
 	ErrInvalidParameters    = errors.New("invalid parameters")
 	ErrRateLimitExceeded    = errors.New("rate limit exceeded")
 	ErrServer               = errors.New("server error")
@@ -2,10 +2,15 @@ package http_client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Client struct {
@@ -13,6 +18,8 @@ type Client struct {
 	Header  http.Header
 
 	httpClient *http.Client
+	breaker    *CircuitBreaker
+	logger     *slog.Logger
 }
 
 // NewClient creates a new HTTP client with default settings and optional configurations.
@@ -29,6 +36,34 @@ func (c *Client) SetBaseURL(baseURL string) {
 	c.BaseURL = baseURL
 }
 
+// Clone method returns a copy of the client instance sending requests to another base URL with the same headers and HTTP client.
+func (c *Client) Clone(baseURL string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		Header:     c.Header.Clone(),
+		httpClient: c.httpClient,
+		breaker:    c.breaker,
+		logger:     c.logger,
+	}
+}
+
+// SetHTTPClient method sets the underlying HTTP client used to send requests, e.g. to use a custom transport.
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.httpClient = httpClient
+}
+
+// SetCircuitBreaker method sets the circuit breaker failing requests fast while the API is failing. The circuit of a
+// request is scoped to the base URL of the client and to the model of its context, see WithModel.
+func (c *Client) SetCircuitBreaker(breaker *CircuitBreaker) {
+	c.breaker = breaker
+}
+
+// SetLogger method sets the logger of the requests: successful ones are logged at debug level with their headers, the
+// redactedHeaders being redacted, and failed ones at warning level.
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
 // SetHeader method sets a single header field and its value in the client instance.
 // These headers will be applied to all requests from this client instance.
 func (c *Client) SetHeader(key, value string) {
@@ -50,22 +85,72 @@ func (c *Client) SetBearer(token string) {
 
 // NewRequest method constructs a new HTTP request.
 func (c *Client) NewRequest(method, path string, body io.Reader) (*http.Request, error) {
+	return c.NewRequestWithContext(context.Background(), method, path, body)
+}
+
+// NewRequestWithContext method constructs a new HTTP request bound to the given context.
+func (c *Client) NewRequestWithContext(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
 	url := c.BaseURL + path
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header = c.Header
+	if header := HeaderFromContext(ctx); header != nil {
+		// The headers of the client are shared by its requests.
+		req.Header = c.Header.Clone()
+		for key, values := range header {
+			req.Header[key] = values
+		}
+	}
 	return req, err
 }
 
+type headerKey struct{}
+
+// WithHeader returns a context setting a header field of the requests made with it, in addition to the fields already
+// set by ctx and overriding the headers of the client.
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	header := HeaderFromContext(ctx).Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(key, value)
+	return context.WithValue(ctx, headerKey{}, header)
+}
+
+// HeaderFromContext returns the header fields set by ctx.
+func HeaderFromContext(ctx context.Context) http.Header {
+	header, _ := ctx.Value(headerKey{}).(http.Header)
+	return header
+}
+
+// Do method sends the request and decodes the JSON response body into out.
+//
+// When out is nil, the response is returned with its body unread so it can be consumed by the caller, e.g. for streaming.
+// Responses with an error status are always consumed and converted to an error.
 func (c *Client) Do(req *http.Request, out interface{}) (*http.Response, error) {
+	if c.breaker == nil {
+		return c.do(req, out)
+	}
+	done, err := c.breaker.allow(CircuitScope{BaseURL: c.BaseURL, Model: modelFromContext(req.Context())})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, out)
+	done(err)
+	return resp, err
+}
+
+func (c *Client) do(req *http.Request, out interface{}) (*http.Response, error) {
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
+	c.log(req, resp, err, time.Since(start))
 	if err != nil {
 		return nil, err
 	}
 
-	if out == nil {
+	if out == nil && resp.StatusCode == http.StatusOK {
 		return resp, nil
 	}
 
@@ -78,19 +163,19 @@ func (c *Client) Do(req *http.Request, out interface{}) (*http.Response, error)
 
 	switch resp.StatusCode {
 	case http.StatusOK: // 200
-		if out != nil {
-			err := json.NewDecoder(bytes.NewReader(body)).Decode(out)
-			if err != nil {
-				return nil, err
-			}
-			return resp, nil
+		err := json.NewDecoder(bytes.NewReader(body)).Decode(out)
+		if err != nil {
+			return nil, err
 		}
+		return resp, nil
 	case http.StatusBadRequest: // 400
 		return nil, fmt.Errorf("%w: %s", ErrInvalidFormat, string(body))
 	case http.StatusUnauthorized: // 401
 		return nil, fmt.Errorf("%w: %s", ErrAuthenticationFailed, string(body))
 	case http.StatusPaymentRequired: // 402
 		return nil, fmt.Errorf("%w: %s", ErrInsufficientBalance, string(body))
+	case http.StatusNotFound: // 404
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, string(body))
 	case http.StatusUnprocessableEntity: // 422
 		return nil, fmt.Errorf("%w: %s", ErrInvalidParameters, string(body))
 	case http.StatusTooManyRequests: // 429
@@ -102,6 +187,48 @@ func (c *Client) Do(req *http.Request, out interface{}) (*http.Response, error)
 	default:
 		return nil, fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, string(body))
 	}
+}
 
-	return nil, fmt.Errorf("unexpected HTTP status %d", resp.StatusCode)
+// log logs a request once its response headers are received.
+func (c *Client) log(req *http.Request, resp *http.Response, err error, latency time.Duration) {
+	if c.logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.String()),
+		slog.Duration("latency", latency),
+	}
+	level := slog.LevelDebug
+	switch {
+	case err != nil:
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Any("error", err))
+	case resp.StatusCode >= http.StatusBadRequest:
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	default:
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	attrs = append(attrs, slog.Any("header", redactedHeader(req.Header)))
+	c.logger.LogAttrs(req.Context(), level, "http request", attrs...)
+}
+
+// redactedHeaders are the canonical keys of the header fields carrying credentials, whose values aren't logged.
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+
+// redactedHeader logs header fields without the credentials.
+type redactedHeader http.Header
+
+func (h redactedHeader) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for key, values := range h {
+		value := strings.Join(values, ", ")
+		if slices.Contains(redactedHeaders, http.CanonicalHeaderKey(key)) {
+			value = "[REDACTED]"
+		}
+		attrs = append(attrs, slog.String(key, value))
+	}
+	slices.SortFunc(attrs, func(a, b slog.Attr) int { return strings.Compare(a.Key, b.Key) })
+	return slog.GroupValue(attrs...)
 }
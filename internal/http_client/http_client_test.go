@@ -1,6 +1,7 @@
 package http_client_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/roushou/deepseek/internal/http_client"
@@ -63,3 +64,21 @@ func TestNewRequest(t *testing.T) {
 		t.Errorf("Request method incorrect, got %s", req.Method)
 	}
 }
+
+func TestNewRequestWithHeader(t *testing.T) {
+	client, _ := http_client.NewClient("http://example.com")
+	client.SetHeader("Accept", "application/json")
+
+	ctx := http_client.WithHeader(context.Background(), "X-Request-Id", "req-1")
+	ctx = http_client.WithHeader(ctx, "Accept", "text/event-stream")
+	req, err := client.NewRequestWithContext(ctx, "GET", "/test", nil)
+	if err != nil {
+		t.Fatalf("NewRequestWithContext returned an error: %v", err)
+	}
+	if req.Header.Get("X-Request-Id") != "req-1" || req.Header.Get("Accept") != "text/event-stream" {
+		t.Errorf("Context headers not set, got %v", req.Header)
+	}
+	if client.Header.Get("X-Request-Id") != "" || client.Header.Get("Accept") != "application/json" {
+		t.Errorf("Client headers modified, got %v", client.Header)
+	}
+}
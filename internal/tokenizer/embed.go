@@ -0,0 +1,49 @@
+package tokenizer
+
+import (
+	"compress/gzip"
+	"embed"
+	"errors"
+	"io/fs"
+	"sync"
+)
+
+//go:generate go run gen.go
+
+// vocabFile is the DeepSeek-V3 vocabulary written by gen.go, see vocab/README.md.
+const vocabFile = "vocab/deepseek-v3.json.gz"
+
+//go:embed vocab
+var vocab embed.FS
+
+// ErrNoVocabulary is returned by Default when the vocabulary wasn't generated with go generate.
+var ErrNoVocabulary = errors.New("tokenizer: vocabulary not embedded, run go generate")
+
+var defaultTokenizer = sync.OnceValues(func() (*Tokenizer, error) {
+	return loadGzip(vocab, vocabFile)
+})
+
+// Default returns the tokenizer of the embedded DeepSeek-V3 vocabulary. The vocabulary is decoded on first use only,
+// which takes a few hundred milliseconds.
+func Default() (*Tokenizer, error) {
+	return defaultTokenizer()
+}
+
+// loadGzip reads a gzipped tokenizer.json file.
+func loadGzip(fsys fs.FS, name string) (*Tokenizer, error) {
+	f, err := fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoVocabulary
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return Load(r)
+}
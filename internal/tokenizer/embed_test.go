@@ -0,0 +1,42 @@
+package tokenizer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadGzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(`{"model": {"type": "BPE", "vocab": {"H": 0, "i": 1, "Hi": 2}, "merges": ["H i"]}}`))
+	w.Close()
+	fsys := fstest.MapFS{vocabFile: {Data: buf.Bytes()}}
+
+	tok, err := loadGzip(fsys, vocabFile)
+	if err != nil {
+		t.Fatalf("loadGzip() error = %v", err)
+	}
+	if got := tok.Count("Hi"); got != 1 {
+		t.Errorf("Count(%q) = %d; want 1", "Hi", got)
+	}
+
+	if _, err := loadGzip(fstest.MapFS{}, vocabFile); !errors.Is(err, ErrNoVocabulary) {
+		t.Errorf("loadGzip() without vocabulary error = %v; want ErrNoVocabulary", err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	tok, err := Default()
+	if errors.Is(err, ErrNoVocabulary) {
+		t.Skip("vocabulary not generated")
+	}
+	if err != nil {
+		t.Fatalf("Default() error = %v", err)
+	}
+	if got := tok.Count("Hello World"); got != 2 {
+		t.Errorf("Count(%q) = %d; want 2", "Hello World", got)
+	}
+}
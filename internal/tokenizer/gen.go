@@ -0,0 +1,61 @@
+//go:build ignore
+
+// gen downloads the tokenizer.json published with DeepSeek-V3 and writes its BPE model to vocab/deepseek-v3.json.gz,
+// which is embedded by the tokenizer package.
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+const source = "https://huggingface.co/deepseek-ai/DeepSeek-V3/resolve/main/tokenizer.json"
+
+func main() {
+	resp, err := http.Get(source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("GET %s: %s", source, resp.Status)
+	}
+
+	// Only the BPE model is kept, the normalizers and special tokens aren't used to count tokens.
+	var file struct {
+		Model struct {
+			Type   string          `json:"type"`
+			Vocab  json.RawMessage `json:"vocab"`
+			Merges json.RawMessage `json:"merges"`
+		} `json:"model"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&file); err != nil {
+		log.Fatal(err)
+	}
+	if file.Model.Type != "BPE" {
+		log.Fatalf("unexpected tokenizer model %q", file.Model.Type)
+	}
+
+	out, err := os.Create("vocab/deepseek-v3.json.gz")
+	if err != nil {
+		log.Fatal(err)
+	}
+	w, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := json.NewEncoder(w).Encode(map[string]any{"model": file.Model}); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("wrote vocab/deepseek-v3.json.gz from", source)
+}
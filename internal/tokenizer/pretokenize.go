@@ -0,0 +1,84 @@
+package tokenizer
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The pre-tokenizer mirrors the split sequence declared in DeepSeek's tokenizer.json. Each pattern isolates its matches
+// from the surrounding text, and every pattern is applied to the pieces produced by the previous one.
+var (
+	digitsPattern = regexp.MustCompile(`\p{N}{1,3}`)
+	cjkPattern    = regexp.MustCompile(`[一-龥぀-ゟ゠-ヿ]+`)
+	// The upstream pattern ends with `\s+(?!\S)|\s+`. RE2 has no lookahead so it is handled in splitWords instead.
+	wordsPattern = regexp.MustCompile("[!\"#$%&'()*+,\\-./:;<=>?@\\[\\\\\\]^_`{|}~][A-Za-z]+|[^\\r\\n\\p{L}\\p{P}\\p{S}]?[\\p{L}\\p{M}]+| ?[\\p{P}\\p{S}]+[\\r\\n]*|\\s*[\\r\\n]+|\\s+")
+)
+
+// pretokenize splits text into the pieces that are independently encoded by the BPE model.
+func pretokenize(text string) []string {
+	pieces := []string{text}
+	pieces = splitIsolated(pieces, func(s string) [][]int { return digitsPattern.FindAllStringIndex(s, -1) })
+	pieces = splitIsolated(pieces, func(s string) [][]int { return cjkPattern.FindAllStringIndex(s, -1) })
+	pieces = splitIsolated(pieces, splitWords)
+	return pieces
+}
+
+// splitIsolated splits every piece around the matches returned by find, keeping both the matches and the text between
+// them as separate pieces.
+func splitIsolated(pieces []string, find func(string) [][]int) []string {
+	out := make([]string, 0, len(pieces))
+	for _, piece := range pieces {
+		prev := 0
+		for _, loc := range find(piece) {
+			if loc[0] > prev {
+				out = append(out, piece[prev:loc[0]])
+			}
+			if loc[1] > loc[0] {
+				out = append(out, piece[loc[0]:loc[1]])
+			}
+			prev = loc[1]
+		}
+		if prev < len(piece) {
+			out = append(out, piece[prev:])
+		}
+	}
+	return out
+}
+
+// splitWords finds the matches of wordsPattern while emulating the `\s+(?!\S)` alternative: a run of whitespace that is
+// followed by a non-whitespace character leaves its last character to the next piece.
+func splitWords(s string) [][]int {
+	var locs [][]int
+	for start := 0; start < len(s); {
+		loc := wordsPattern.FindStringIndex(s[start:])
+		if loc == nil {
+			break
+		}
+		from, to := start+loc[0], start+loc[1]
+		if to < len(s) && isSpaceRun(s[from:to]) {
+			next, _ := utf8.DecodeRuneInString(s[to:])
+			if !unicode.IsSpace(next) && utf8.RuneCountInString(s[from:to]) > 1 {
+				_, size := utf8.DecodeLastRuneInString(s[from:to])
+				to -= size
+			}
+		}
+		if to == from {
+			// Guard against empty matches so the scan always moves forward.
+			_, size := utf8.DecodeRuneInString(s[from:])
+			to = from + size
+		}
+		locs = append(locs, []int{from, to})
+		start = to
+	}
+	return locs
+}
+
+func isSpaceRun(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,182 @@
+// Package tokenizer implements the byte-level BPE tokenizer used by DeepSeek models.
+package tokenizer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// maxCacheEntries bounds the memoized encodings of pre-tokenized pieces.
+const maxCacheEntries = 1 << 16
+
+type Tokenizer struct {
+	vocab  map[string]int
+	ranks  map[pair]int
+	byteTo [256]string
+
+	mu    sync.RWMutex
+	cache map[string][]int
+}
+
+type pair struct {
+	left, right string
+}
+
+// New creates a tokenizer from a vocabulary and an ordered list of merges written as "left right".
+func New(vocab map[string]int, merges []string) (*Tokenizer, error) {
+	ranks := make(map[pair]int, len(merges))
+	for i, merge := range merges {
+		left, right, ok := strings.Cut(merge, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid merge %q at index %d", merge, i)
+		}
+		ranks[pair{left, right}] = i
+	}
+
+	t := &Tokenizer{
+		vocab: vocab,
+		ranks: ranks,
+		cache: map[string][]int{},
+	}
+	for b, r := range byteEncoder() {
+		t.byteTo[b] = string(r)
+	}
+	return t, nil
+}
+
+// Load reads a HuggingFace tokenizer.json file describing a BPE model.
+func Load(r io.Reader) (*Tokenizer, error) {
+	var file struct {
+		Model struct {
+			Type   string            `json:"type"`
+			Vocab  map[string]int    `json:"vocab"`
+			Merges []json.RawMessage `json:"merges"`
+		} `json:"model"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	if file.Model.Type != "" && file.Model.Type != "BPE" {
+		return nil, fmt.Errorf("unsupported tokenizer model %q", file.Model.Type)
+	}
+	if len(file.Model.Vocab) == 0 {
+		return nil, errors.New("tokenizer vocabulary is empty")
+	}
+
+	// Merges are either written as "left right" or, in newer files, as ["left", "right"].
+	merges := make([]string, 0, len(file.Model.Merges))
+	for _, raw := range file.Model.Merges {
+		var merge string
+		if err := json.Unmarshal(raw, &merge); err == nil {
+			merges = append(merges, merge)
+			continue
+		}
+		var parts []string
+		if err := json.Unmarshal(raw, &parts); err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid merge %s", string(raw))
+		}
+		merges = append(merges, parts[0]+" "+parts[1])
+	}
+
+	return New(file.Model.Vocab, merges)
+}
+
+// Encode returns the token IDs of text. Symbols missing from the vocabulary are reported as -1.
+func (t *Tokenizer) Encode(text string) []int {
+	var ids []int
+	for _, piece := range pretokenize(text) {
+		ids = append(ids, t.encodePiece(piece)...)
+	}
+	return ids
+}
+
+// Count returns the number of tokens in text.
+func (t *Tokenizer) Count(text string) int {
+	var count int
+	for _, piece := range pretokenize(text) {
+		count += len(t.encodePiece(piece))
+	}
+	return count
+}
+
+func (t *Tokenizer) encodePiece(piece string) []int {
+	t.mu.RLock()
+	ids, ok := t.cache[piece]
+	t.mu.RUnlock()
+	if ok {
+		return ids
+	}
+
+	symbols := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		symbols[i] = t.byteTo[piece[i]]
+	}
+	symbols = t.merge(symbols)
+
+	ids = make([]int, len(symbols))
+	for i, symbol := range symbols {
+		id, ok := t.vocab[symbol]
+		if !ok {
+			id = -1
+		}
+		ids[i] = id
+	}
+
+	t.mu.Lock()
+	if len(t.cache) >= maxCacheEntries {
+		t.cache = map[string][]int{}
+	}
+	t.cache[piece] = ids
+	t.mu.Unlock()
+	return ids
+}
+
+// merge repeatedly applies the lowest ranked merge until no adjacent pair can be merged.
+func (t *Tokenizer) merge(symbols []string) []string {
+	for len(symbols) > 1 {
+		best, bestRank := -1, len(t.ranks)
+		for i := 0; i < len(symbols)-1; i++ {
+			if rank, ok := t.ranks[pair{symbols[i], symbols[i+1]}]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		target := pair{symbols[best], symbols[best+1]}
+		merged := symbols[:0]
+		for i := 0; i < len(symbols); i++ {
+			if i < len(symbols)-1 && symbols[i] == target.left && symbols[i+1] == target.right {
+				merged = append(merged, target.left+target.right)
+				i++
+				continue
+			}
+			merged = append(merged, symbols[i])
+		}
+		symbols = merged
+	}
+	return symbols
+}
+
+// byteEncoder maps every byte to a printable rune the same way GPT-2 style byte-level BPE vocabularies do.
+func byteEncoder() map[byte]rune {
+	encoder := make(map[byte]rune, 256)
+	printable := func(b int) bool {
+		return (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF)
+	}
+	n := 0
+	for b := 0; b < 256; b++ {
+		if printable(b) {
+			encoder[byte(b)] = rune(b)
+			continue
+		}
+		encoder[byte(b)] = rune(256 + n)
+		n++
+	}
+	return encoder
+}
@@ -0,0 +1,89 @@
+package tokenizer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPretokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "Words",
+			input:    "Hello world",
+			expected: []string{"Hello", " world"},
+		},
+		{
+			name:     "Digits are grouped by three",
+			input:    "1234567",
+			expected: []string{"123", "456", "7"},
+		},
+		{
+			name:     "Chinese text is isolated",
+			input:    "Hi你好",
+			expected: []string{"Hi", "你好"},
+		},
+		{
+			name:     "Whitespace run before a word",
+			input:    "a   b",
+			expected: []string{"a", "  ", " b"},
+		},
+		{
+			name:     "Punctuation",
+			input:    "end.\n",
+			expected: []string{"end", ".\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pretokenize(tt.input)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("pretokenize(%q) = %q; want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := `{
+		"model": {
+			"type": "BPE",
+			"vocab": {"H": 0, "e": 1, "l": 2, "o": 3, "He": 4, "ll": 5, "llo": 6, "Hello": 7},
+			"merges": ["H e", ["l", "l"], "ll o", "He llo"]
+		}
+	}`
+
+	tok, err := Load(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := tok.Encode("Hello"); !reflect.DeepEqual(got, []int{7}) {
+		t.Errorf("Encode(%q) = %v; want [7]", "Hello", got)
+	}
+	if got := tok.Count("Hell"); got != 2 {
+		t.Errorf("Count(%q) = %d; want 2", "Hell", got)
+	}
+	if got := tok.Encode("x"); !reflect.DeepEqual(got, []int{-1}) {
+		t.Errorf("Encode(%q) = %v; want [-1]", "x", got)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	inputs := []string{
+		`not json`,
+		`{"model": {"type": "Unigram", "vocab": {"a": 0}}}`,
+		`{"model": {"type": "BPE", "vocab": {}}}`,
+		`{"model": {"type": "BPE", "vocab": {"a": 0}, "merges": ["ab"]}}`,
+	}
+	for _, input := range inputs {
+		if _, err := Load(strings.NewReader(input)); err == nil {
+			t.Errorf("Load(%q) expected an error", input)
+		}
+	}
+}
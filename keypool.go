@@ -0,0 +1,381 @@
+package deepseek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// ErrNoAPIKey is returned when every key of a KeyPool is quarantined or cooling down.
+var ErrNoAPIKey = errors.New("no API key available")
+
+// APIKeyProvider provides the API keys of a KeyPool, e.g. from a secret manager so that keys can be rotated at runtime.
+type APIKeyProvider interface {
+	APIKeys(ctx context.Context) ([]string, error)
+}
+
+// StaticKeys is an APIKeyProvider of fixed keys.
+type StaticKeys []string
+
+func (k StaticKeys) APIKeys(context.Context) ([]string, error) {
+	return k, nil
+}
+
+// KeySelection is the strategy of a KeyPool to pick the key of a request among the available ones.
+type KeySelection int
+
+const (
+	// KeyRoundRobin uses the keys in turn.
+	KeyRoundRobin KeySelection = iota
+
+	// KeyLeastRecentlyLimited uses the key rate limited the longest time ago, keys never rate limited first. Keys
+	// limited at the same time, e.g. never, are used in turn.
+	KeyLeastRecentlyLimited
+)
+
+// KeyPoolConfig configures a KeyPool.
+type KeyPoolConfig struct {
+	Provider APIKeyProvider
+
+	// Selection defaults to KeyRoundRobin.
+	Selection KeySelection
+
+	// RefreshInterval is how often Run reloads the keys from the provider. Defaults to 5 minutes.
+	RefreshInterval time.Duration
+
+	// Cooldown is how long a rate limited key is set aside when the response has no Retry-After header. Defaults to 1 minute.
+	Cooldown time.Duration
+
+	// OnQuarantine is called when a key is quarantined because the API rejected it, with the statistics of the key.
+	OnQuarantine func(stats KeyStats)
+
+	// OnError is called with the errors of background refreshes.
+	OnError func(err error)
+
+	// Clock defaults to SystemClock.
+	Clock Clock
+}
+
+// KeyStats are the statistics of a key of a KeyPool.
+type KeyStats struct {
+	// Key is the masked key, only showing its last characters.
+	Key string
+
+	Requests    int64
+	Failures    int64
+	RateLimited int64
+
+	// Quarantined reports whether the key was rejected with a 401 or 402 status, and why.
+	Quarantined bool
+	Reason      string
+
+	// CooldownUntil is when a rate limited key is used again.
+	CooldownUntil time.Time
+
+	// LastRateLimited is when the key was last rate limited.
+	LastRateLimited time.Time
+
+	// PromptTokens, CompletionTokens and Cost are the usage of the completions served with the key, counted when the
+	// pool is set WithKeyPool or its Middleware is used.
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             Amount
+}
+
+// KeyPool spreads requests over several API keys, see WithKeyPool.
+//
+// Keys rejected with a 401 or 402 status are quarantined until reinstated, and keys rate limited with a 429 status
+// cool down while the other keys keep serving requests.
+type KeyPool struct {
+	config KeyPoolConfig
+
+	mu   sync.Mutex
+	keys []*pooledKey
+	next int
+}
+
+type pooledKey struct {
+	key   string
+	stats KeyStats
+}
+
+// NewKeyPool creates a key pool and loads its keys from the provider.
+func NewKeyPool(ctx context.Context, config KeyPoolConfig) (*KeyPool, error) {
+	if config.Provider == nil {
+		return nil, errors.New("missing API key provider")
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 5 * time.Minute
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = time.Minute
+	}
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	pool := &KeyPool{config: config}
+	if err := pool.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// Refresh reloads the keys from the provider. The state of the keys still provided is kept.
+func (p *KeyPool) Refresh(ctx context.Context) error {
+	keys, err := p.config.Provider.APIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return errors.New("no API key provided")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	existing := make(map[string]*pooledKey, len(p.keys))
+	for _, key := range p.keys {
+		existing[key.key] = key
+	}
+	pooled := make([]*pooledKey, 0, len(keys))
+	for _, key := range keys {
+		if k, ok := existing[key]; ok {
+			pooled = append(pooled, k)
+			continue
+		}
+		pooled = append(pooled, &pooledKey{key: key, stats: KeyStats{Key: maskKey(key)}})
+	}
+	p.keys = pooled
+	return nil
+}
+
+// Run refreshes the keys at the configured interval until ctx is done.
+func (p *KeyPool) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.config.Clock.After(p.config.RefreshInterval):
+			if err := p.Refresh(ctx); err != nil && p.config.OnError != nil {
+				p.config.OnError(err)
+			}
+		}
+	}
+}
+
+// Reinstate puts a quarantined key back in rotation, e.g. once its balance was topped up.
+func (p *KeyPool) Reinstate(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range p.keys {
+		if k.key == key {
+			k.stats.Quarantined = false
+			k.stats.Reason = ""
+		}
+	}
+}
+
+// Stats returns the statistics of every key.
+func (p *KeyPool) Stats() []KeyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]KeyStats, len(p.keys))
+	for i, key := range p.keys {
+		stats[i] = key.stats
+	}
+	return stats
+}
+
+// Transport returns a transport authenticating every request with a key of the pool before sending it with base,
+// http.DefaultTransport when nil.
+func (p *KeyPool) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &keyPoolTransport{pool: p, base: base}
+}
+
+type keyPoolTransport struct {
+	pool *KeyPool
+	base http.RoundTripper
+}
+
+func (t *keyPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := t.pool.pick()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// A RoundTripper must not modify the request, and the headers are shared by the requests of a client.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+key.key)
+	resp, err := t.base.RoundTrip(req)
+	t.pool.observe(key, resp, err)
+	if slot, ok := req.Context().Value(keySlotKey{}).(*keySlot); ok && err == nil && resp.StatusCode < http.StatusBadRequest {
+		slot.set(key)
+	}
+	return resp, err
+}
+
+type keySlotKey struct{}
+
+// keySlot receives the key of the request which served a completion, see KeyPool.Middleware.
+type keySlot struct {
+	mu  sync.Mutex
+	key *pooledKey
+}
+
+func (s *keySlot) set(key *pooledKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+}
+
+func (s *keySlot) get() *pooledKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key
+}
+
+// Middleware returns a middleware adding the usage and cost of the completions to the statistics of the key which
+// served them, set by the transport of the pool. WithKeyPool adds it to the client.
+func (p *KeyPool) Middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				slot := &keySlot{}
+				completion, err := next.CreateCompletion(context.WithValue(ctx, keySlotKey{}, slot), args)
+				if key := slot.get(); key != nil && completion != nil {
+					p.addUsage(key, completion.Usage, servedModel(args.Model, completion.Model))
+				}
+				return completion, err
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				slot := &keySlot{}
+				stream := next.CreateStreamCompletion(context.WithValue(ctx, keySlotKey{}, slot), args)
+				var acc StreamAccumulator
+				var received bool
+				stream.OnChunk(func(chunk StreamCompletionChunk) {
+					received = true
+					acc.Add(chunk)
+				})
+				stream.OnDone(func(error) {
+					key := slot.get()
+					if key == nil || !received {
+						return
+					}
+					usage, ok := acc.Usage()
+					if !ok {
+						usage = estimateStreamUsage(args, &acc)
+					}
+					p.addUsage(key, usage, servedModel(args.Model, acc.Response().Model))
+				})
+				return stream
+			},
+		}
+	}
+}
+
+// addUsage adds the usage of a completion served by model to the statistics of a key.
+func (p *KeyPool) addUsage(key *pooledKey, usage CompletionUsage, model ModelID) {
+	cost := Cost(usage, model, p.config.Clock.Now())
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key.stats.PromptTokens += usage.PromptTokens
+	key.stats.CompletionTokens += usage.CompletionTokens
+	key.stats.Cost = key.stats.Cost.Add(cost)
+}
+
+// pick selects the key of a request.
+func (p *KeyPool) pick() (*pooledKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.config.Clock.Now()
+	var picked *pooledKey
+	var pickedIndex int
+	var nextAvailable time.Time
+	for i := range p.keys {
+		index := (p.next + i) % len(p.keys)
+		key := p.keys[index]
+		if key.stats.Quarantined {
+			continue
+		}
+		if now.Before(key.stats.CooldownUntil) {
+			if nextAvailable.IsZero() || key.stats.CooldownUntil.Before(nextAvailable) {
+				nextAvailable = key.stats.CooldownUntil
+			}
+			continue
+		}
+		if picked == nil || key.stats.LastRateLimited.Before(picked.stats.LastRateLimited) {
+			picked, pickedIndex = key, index
+		}
+		if p.config.Selection == KeyRoundRobin {
+			break
+		}
+	}
+
+	if picked == nil {
+		if nextAvailable.IsZero() {
+			return nil, fmt.Errorf("%w: every key is quarantined", ErrNoAPIKey)
+		}
+		return nil, fmt.Errorf("%w: every key is cooling down until %s", ErrNoAPIKey, nextAvailable.Format(time.RFC3339))
+	}
+	// The keys are scanned from the one after the last picked, so that ties are broken in turn.
+	p.next = pickedIndex + 1
+	picked.stats.Requests++
+	return picked, nil
+}
+
+// observe updates the state of a key with the response of a request.
+func (p *KeyPool) observe(key *pooledKey, resp *http.Response, err error) {
+	p.mu.Lock()
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		key.stats.Failures++
+	}
+	if err != nil {
+		p.mu.Unlock()
+		return
+	}
+
+	var quarantined bool
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusPaymentRequired:
+		quarantined = !key.stats.Quarantined
+		key.stats.Quarantined = true
+		key.stats.Reason = http.StatusText(resp.StatusCode)
+	case http.StatusTooManyRequests:
+		now := p.config.Clock.Now()
+		cooldown := p.config.Cooldown
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			cooldown = time.Duration(seconds) * time.Second
+		}
+		key.stats.RateLimited++
+		key.stats.LastRateLimited = now
+		key.stats.CooldownUntil = now.Add(cooldown)
+	}
+	stats := key.stats
+	p.mu.Unlock()
+
+	if quarantined && p.config.OnQuarantine != nil {
+		p.config.OnQuarantine(stats)
+	}
+}
+
+// maskKey hides all but the last characters of a key.
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
@@ -0,0 +1,199 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+// rotatingKeys is an APIKeyProvider whose keys can be replaced.
+type rotatingKeys struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *rotatingKeys) APIKeys(context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.keys, nil
+}
+
+func (r *rotatingKeys) set(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = keys
+}
+
+func TestKeyPool(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	provider := &rotatingKeys{keys: []string{"sk-key-0001", "sk-key-0002", "sk-key-0003"}}
+	var quarantined []deepseek.KeyStats
+	pool, err := deepseek.NewKeyPool(context.Background(), deepseek.KeyPoolConfig{
+		Provider:     provider,
+		Clock:        clock,
+		OnQuarantine: func(stats deepseek.KeyStats) { quarantined = append(quarantined, stats) },
+	})
+	if err != nil {
+		t.Fatalf("NewKeyPool() error = %v", err)
+	}
+	client, err := deepseek.NewClient("", deepseek.WithBaseURL(server.URL), deepseek.WithKeyPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server.Enqueue(
+		deepseektest.Text(deepseek.DeepSeekChat, "ok"),
+		deepseektest.Error(http.StatusPaymentRequired, "insufficient balance"),
+		deepseektest.Text(deepseek.DeepSeekChat, "ok"),
+		deepseektest.Error(http.StatusTooManyRequests, "slow down"),
+		deepseektest.Text(deepseek.DeepSeekChat, "ok"),
+		deepseektest.Text(deepseek.DeepSeekChat, "ok"),
+		deepseektest.Text(deepseek.DeepSeekChat, "ok"),
+	)
+	for i := 0; i < 6; i++ {
+		_, _ = client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat})
+	}
+	// The rate limited key is used again once cooled down.
+	clock.Advance(time.Minute)
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat}); err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+
+	want := []string{"0001", "0002", "0003", "0001", "0003", "0003", "0001"}
+	requests := server.Requests()
+	if len(requests) != len(want) {
+		t.Fatalf("requests = %d; want %d", len(requests), len(want))
+	}
+	for i, req := range requests {
+		if got := req.Header.Get("Authorization"); got != "Bearer sk-key-"+want[i] {
+			t.Errorf("request #%d Authorization = %q; want key %s", i, got, want[i])
+		}
+	}
+
+	if len(quarantined) != 1 || quarantined[0].Key != "****0002" {
+		t.Errorf("quarantined = %+v; want key 0002", quarantined)
+	}
+	stats := pool.Stats()
+	if stats[0].Requests != 3 || stats[0].RateLimited != 1 || stats[1].Failures != 1 || !stats[1].Quarantined {
+		t.Errorf("Stats() = %+v", stats)
+	}
+
+	// Rotated keys replace the old ones, keeping the state of the remaining keys.
+	provider.set("sk-key-0002")
+	if err := pool.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	_, err = client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat})
+	if !errors.Is(err, deepseek.ErrNoAPIKey) {
+		t.Errorf("CreateCompletion() error = %v; want ErrNoAPIKey", err)
+	}
+
+	pool.Reinstate("sk-key-0002")
+	server.Enqueue(deepseektest.Text(deepseek.DeepSeekChat, "ok"))
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat}); err != nil {
+		t.Errorf("CreateCompletion() after Reinstate() error = %v", err)
+	}
+}
+
+func TestKeyPoolLeastRecentlyLimited(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	pool, err := deepseek.NewKeyPool(context.Background(), deepseek.KeyPoolConfig{
+		Provider:  deepseek.StaticKeys{"sk-key-0001", "sk-key-0002"},
+		Selection: deepseek.KeyLeastRecentlyLimited,
+		Cooldown:  time.Second,
+		Clock:     clock,
+	})
+	if err != nil {
+		t.Fatalf("NewKeyPool() error = %v", err)
+	}
+	client, err := deepseek.NewClient("", deepseek.WithBaseURL(server.URL), deepseek.WithKeyPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server.Enqueue(
+		deepseektest.Error(http.StatusTooManyRequests, "slow down"),
+		deepseektest.Error(http.StatusTooManyRequests, "slow down"),
+		deepseektest.Text(deepseek.DeepSeekChat, "ok"),
+		deepseektest.Text(deepseek.DeepSeekChat, "ok"),
+	)
+	_, _ = client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{})
+	clock.Advance(time.Second)
+	_, _ = client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{})
+	clock.Advance(time.Second)
+	for i := 0; i < 2; i++ {
+		_, _ = client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{})
+	}
+
+	// Key 0001 was limited first, so it is preferred over 0002 once both cooled down.
+	want := []string{"0001", "0002", "0001", "0001"}
+	for i, req := range server.Requests() {
+		if got := req.Header.Get("Authorization"); got != "Bearer sk-key-"+want[i] {
+			t.Errorf("request #%d Authorization = %q; want key %s", i, got, want[i])
+		}
+	}
+}
+
+func TestKeyPoolUsage(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	pool, err := deepseek.NewKeyPool(context.Background(), deepseek.KeyPoolConfig{
+		Provider:  deepseek.StaticKeys{"sk-key-0001", "sk-key-0002"},
+		Selection: deepseek.KeyLeastRecentlyLimited,
+	})
+	if err != nil {
+		t.Fatalf("NewKeyPool() error = %v", err)
+	}
+	client, err := deepseek.NewClient("", deepseek.WithBaseURL(server.URL), deepseek.WithKeyPool(pool))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	server.Enqueue(
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello World"),
+		deepseektest.Stream(deepseektest.StreamScript{Chunks: deepseektest.TextChunks(deepseek.DeepSeekChat, "Hello there World")}),
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello"),
+	)
+	args := deepseek.CompletionArgs{Model: deepseek.DeepSeekChat, Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}}}
+	if _, err := client.Chats.CreateCompletion(context.Background(), args); err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{
+		Model:         args.Model,
+		Messages:      args.Messages,
+		StreamOptions: &deepseek.StreamOptions{IncludeUsage: true},
+	})
+	for stream.Next() {
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := client.Chats.CreateCompletion(context.Background(), args); err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+
+	// Keys never rate limited are used in turn.
+	want := []string{"0001", "0002", "0001"}
+	for i, req := range server.Requests() {
+		if got := req.Header.Get("Authorization"); got != "Bearer sk-key-"+want[i] {
+			t.Errorf("request #%d Authorization = %q; want key %s", i, got, want[i])
+		}
+	}
+
+	stats := pool.Stats()
+	if stats[0].PromptTokens != 20 || stats[0].CompletionTokens != 3 || stats[1].CompletionTokens == 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	usage := deepseek.CompletionUsage{PromptTokens: 20, PromptCacheMissTokens: 20, CompletionTokens: 3}
+	if want := deepseek.Cost(usage, deepseek.DeepSeekChat, time.Now()); math.Abs(stats[0].Cost.USD-want.USD) > 1e-12 {
+		t.Errorf("Cost = %+v; want %+v", stats[0].Cost, want)
+	}
+}
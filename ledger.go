@@ -0,0 +1,373 @@
+package deepseek
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// UsageRecord is the usage of a single completion request.
+type UsageRecord struct {
+	// Time is when the request was sent.
+	Time time.Time `json:"time"`
+
+	// Model is the model which served the request, as reported by the API, e.g. the model of a FallbackTarget. It is
+	// the model requested when the request failed.
+	Model ModelID `json:"model"`
+
+	// Tags are the tags carried by the context of the request, see WithTags.
+	Tags []string `json:"tags,omitempty"`
+
+	// Stream indicates whether the completion was streamed.
+	Stream bool `json:"stream"`
+
+	// Usage is the usage reported by the API.
+	Usage CompletionUsage `json:"usage"`
+
+	// Estimated indicates that Usage was estimated locally because the API didn't report it, e.g. for streams without StreamOptions.IncludeUsage.
+	Estimated bool `json:"estimated,omitempty"`
+
+	// Latency is the duration of the request, until the end of the stream for streaming completions.
+	Latency time.Duration `json:"latency"`
+
+	// Cost is the cost of the usage.
+	Cost Amount `json:"cost"`
+
+	// Error is the error returned by the request, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// LedgerSink stores usage records.
+type LedgerSink interface {
+	// Append stores a record.
+	Append(record UsageRecord) error
+
+	// Records returns the records made in the [since, until) time window. A zero time leaves the window open on that side.
+	Records(since, until time.Time) ([]UsageRecord, error)
+}
+
+// LedgerQuery selects the records aggregated by a ledger.
+type LedgerQuery struct {
+	// Since is the inclusive start of the time window. Zero means no lower bound.
+	Since time.Time
+
+	// Until is the exclusive end of the time window. Zero means no upper bound.
+	Until time.Time
+
+	// Tag restricts the query to records carrying this tag when not empty.
+	Tag string
+
+	// Model restricts the query to records of this model when not empty.
+	Model ModelID
+}
+
+// UsageTotals aggregates usage records.
+type UsageTotals struct {
+	Requests              int64         `json:"requests"`
+	Errors                int64         `json:"errors"`
+	PromptTokens          int64         `json:"prompt_tokens"`
+	PromptCacheHitTokens  int64         `json:"prompt_cache_hit_tokens"`
+	PromptCacheMissTokens int64         `json:"prompt_cache_miss_tokens"`
+	CompletionTokens      int64         `json:"completion_tokens"`
+	ReasoningTokens       int64         `json:"reasoning_tokens"`
+	TotalTokens           int64         `json:"total_tokens"`
+	Latency               time.Duration `json:"latency"`
+	Cost                  Amount        `json:"cost"`
+}
+
+// Add accumulates a record.
+func (t *UsageTotals) Add(record UsageRecord) {
+	t.Requests++
+	if record.Error != "" {
+		t.Errors++
+	}
+	t.PromptTokens += record.Usage.PromptTokens
+	t.PromptCacheHitTokens += record.Usage.PromptCacheHitTokens
+	t.PromptCacheMissTokens += record.Usage.PromptCacheMissTokens
+	t.CompletionTokens += record.Usage.CompletionTokens
+	t.ReasoningTokens += record.Usage.CompletionTokensDetails.ReasoningTokens
+	t.TotalTokens += record.Usage.TotalTokens
+	t.Latency += record.Latency
+	t.Cost = t.Cost.Add(record.Cost)
+}
+
+// Ledger records the usage and cost of completions, see WithLedger and Ledger.Middleware.
+type Ledger struct {
+	sink   LedgerSink
+	prices *PriceTable
+}
+
+// NewLedger creates a ledger storing records in sink. Costs are computed using DefaultPrices.
+func NewLedger(sink LedgerSink) *Ledger {
+	return &Ledger{sink: sink, prices: DefaultPrices}
+}
+
+// Record stores a record, computing its cost when not set.
+func (l *Ledger) Record(record UsageRecord) error {
+	if record.Cost == (Amount{}) {
+		record.Cost = l.prices.Cost(record.Usage, record.Model, record.Time)
+	}
+	return l.sink.Append(record)
+}
+
+// Records returns the records matching the query.
+func (l *Ledger) Records(query LedgerQuery) ([]UsageRecord, error) {
+	records, err := l.sink.Records(query.Since, query.Until)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := records[:0]
+	for _, record := range records {
+		if query.Tag != "" && !containsTag(record.Tags, query.Tag) {
+			continue
+		}
+		if query.Model != "" && record.Model != query.Model {
+			continue
+		}
+		matching = append(matching, record)
+	}
+	return matching, nil
+}
+
+// Totals aggregates the records matching the query.
+func (l *Ledger) Totals(query LedgerQuery) (UsageTotals, error) {
+	records, err := l.Records(query)
+	if err != nil {
+		return UsageTotals{}, err
+	}
+
+	var totals UsageTotals
+	for _, record := range records {
+		totals.Add(record)
+	}
+	return totals, nil
+}
+
+// TotalsByTag aggregates the records matching the query for each tag. Records without tags are aggregated under the empty tag.
+func (l *Ledger) TotalsByTag(query LedgerQuery) (map[string]UsageTotals, error) {
+	records, err := l.Records(query)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := map[string]UsageTotals{}
+	for _, record := range records {
+		tags := record.Tags
+		if len(tags) == 0 {
+			tags = []string{""}
+		}
+		for _, tag := range tags {
+			total := totals[tag]
+			total.Add(record)
+			totals[tag] = total
+		}
+	}
+	return totals, nil
+}
+
+// Middleware returns a middleware recording the completions in the ledger.
+func (l *Ledger) Middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				start := time.Now()
+				completion, err := next.CreateCompletion(ctx, args)
+				l.recordCompletion(ctx, args, completion, err, start)
+				return completion, err
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				start := time.Now()
+				stream := next.CreateStreamCompletion(ctx, args)
+				l.observeStream(ctx, args, stream, start)
+				return stream
+			},
+		}
+	}
+}
+
+// recordCompletion records a non-streaming completion. Errors of the sink are ignored so they don't fail the request.
+func (l *Ledger) recordCompletion(ctx context.Context, args CompletionArgs, completion *CompletionResponse, err error, start time.Time) {
+	record := UsageRecord{
+		Time:    start,
+		Model:   args.Model,
+		Tags:    TagsFromContext(ctx),
+		Latency: time.Since(start),
+	}
+	if completion != nil {
+		record.Model = servedModel(args.Model, completion.Model)
+		record.Usage = completion.Usage
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	_ = l.Record(record)
+}
+
+// observeStream records a streaming completion once the stream ends. A stream failing before its first chunk is
+// recorded without usage, since nothing was generated.
+func (l *Ledger) observeStream(ctx context.Context, args StreamCompletionArgs, stream *ssestream.Stream[StreamCompletionChunk], start time.Time) {
+	var acc StreamAccumulator
+	var received bool
+	stream.OnChunk(func(chunk StreamCompletionChunk) {
+		received = true
+		acc.Add(chunk)
+	})
+	stream.OnDone(func(err error) {
+		record := UsageRecord{
+			Time:    start,
+			Model:   servedModel(args.Model, acc.Response().Model),
+			Tags:    TagsFromContext(ctx),
+			Stream:  true,
+			Latency: time.Since(start),
+		}
+		if usage, ok := acc.Usage(); ok {
+			record.Usage = usage
+		} else if received {
+			record.Usage = estimateStreamUsage(args, &acc)
+			record.Estimated = true
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		_ = l.Record(record)
+	})
+}
+
+// estimateStreamUsage estimates the usage of a stream whose usage wasn't reported by the API.
+func estimateStreamUsage(args StreamCompletionArgs, acc *StreamAccumulator) CompletionUsage {
+	var usage CompletionUsage
+	usage.PromptTokens = args.EstimatePromptTokens()
+	for _, choice := range acc.Response().Choices {
+		reasoning := CountTokens(args.Model, acc.ReasoningContent(choice.Index))
+		usage.CompletionTokens += CountTokens(args.Model, choice.Message.Content) + reasoning
+		usage.CompletionTokensDetails.ReasoningTokens += reasoning
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// MemorySink keeps usage records in memory. It is safe for concurrent use.
+type MemorySink struct {
+	mu      sync.Mutex
+	records []UsageRecord
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Append(record UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *MemorySink) Records(since, until time.Time) ([]UsageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []UsageRecord
+	for _, record := range s.records {
+		if inWindow(record.Time, since, until) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// JSONLSink appends usage records to a file, one JSON object per line. It is safe for concurrent use.
+type JSONLSink struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	readOnly bool
+}
+
+// NewJSONLSink opens or creates the file at path to append records to it.
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLSink{path: path, file: file}, nil
+}
+
+// OpenJSONLSink opens the existing file at path to read its records, e.g. to query the ledger of another process.
+// Appending records to it fails.
+func OpenJSONLSink(path string) (*JSONLSink, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLSink{path: path, file: file, readOnly: true}, nil
+}
+
+func (s *JSONLSink) Append(record UsageRecord) error {
+	if s.readOnly {
+		return fmt.Errorf("append to %s: sink opened read-only", s.path)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *JSONLSink) Records(since, until time.Time) ([]UsageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []UsageRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+		if inWindow(record.Time, since, until) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Close closes the underlying file.
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// inWindow reports whether t is in the [since, until) window, a zero bound leaving the window open.
+func inWindow(t, since, until time.Time) bool {
+	if !since.IsZero() && t.Before(since) {
+		return false
+	}
+	if !until.IsZero() && !t.Before(until) {
+		return false
+	}
+	return true
+}
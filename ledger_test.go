@@ -0,0 +1,160 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+)
+
+func newCompletionServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"id\":\"1\",\"model\":\"deepseek-chat\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"id\":\"1\",\"model\":\"deepseek-chat\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"prompt_cache_miss_tokens\":10,\"completion_tokens\":1,\"total_tokens\":11}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"id":"1","model":"deepseek-chat","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"}}],"usage":{"prompt_tokens":10,"prompt_cache_hit_tokens":4,"prompt_cache_miss_tokens":6,"completion_tokens":5,"total_tokens":15}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLedger(t *testing.T) {
+	server := newCompletionServer(t)
+	sink, err := deepseek.NewJSONLSink(filepath.Join(t.TempDir(), "usage.jsonl"))
+	if err != nil {
+		t.Fatalf("NewJSONLSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	ledger := deepseek.NewLedger(sink)
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL), deepseek.WithLedger(ledger))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	ctx := deepseek.WithTags(context.Background(), "team:search")
+	args := deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	}
+	if _, err := client.Chats.CreateCompletion(ctx, args); err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+
+	stream := client.Chats.CreateStreamCompletion(deepseek.WithTags(ctx, "stream"), deepseek.StreamCompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: args.Messages,
+	})
+	for stream.Next() {
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	totals, err := ledger.Totals(deepseek.LedgerQuery{Tag: "team:search"})
+	if err != nil {
+		t.Fatalf("Totals() error = %v", err)
+	}
+	if totals.Requests != 2 || totals.PromptTokens != 20 || totals.CompletionTokens != 6 || totals.PromptCacheHitTokens != 4 {
+		t.Errorf("Totals() = %+v", totals)
+	}
+	if totals.Cost.USD <= 0 {
+		t.Errorf("Totals() cost = %+v; want a positive cost", totals.Cost)
+	}
+
+	byTag, err := ledger.TotalsByTag(deepseek.LedgerQuery{})
+	if err != nil {
+		t.Fatalf("TotalsByTag() error = %v", err)
+	}
+	if byTag["stream"].Requests != 1 || byTag["team:search"].Requests != 2 {
+		t.Errorf("TotalsByTag() = %+v", byTag)
+	}
+
+	future, err := ledger.Totals(deepseek.LedgerQuery{Since: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Totals() error = %v", err)
+	}
+	if future.Requests != 0 {
+		t.Errorf("Totals() in the future = %+v; want no request", future)
+	}
+}
+
+func TestOpenJSONLSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	if _, err := deepseek.OpenJSONLSink(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("OpenJSONLSink() error = %v; want %v", err, fs.ErrNotExist)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenJSONLSink() created the file: %v", err)
+	}
+
+	writer, err := deepseek.NewJSONLSink(path)
+	if err != nil {
+		t.Fatalf("NewJSONLSink() error = %v", err)
+	}
+	record := deepseek.UsageRecord{Model: deepseek.DeepSeekChat, Usage: deepseek.CompletionUsage{PromptTokens: 10}}
+	if err := writer.Append(record); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	writer.Close()
+
+	reader, err := deepseek.OpenJSONLSink(path)
+	if err != nil {
+		t.Fatalf("OpenJSONLSink() error = %v", err)
+	}
+	defer reader.Close()
+	totals, err := deepseek.NewLedger(reader).Totals(deepseek.LedgerQuery{})
+	if err != nil {
+		t.Fatalf("Totals() error = %v", err)
+	}
+	if totals.Requests != 1 || totals.PromptTokens != 10 {
+		t.Errorf("Totals() = %+v", totals)
+	}
+	if err := reader.Append(record); err == nil {
+		t.Error("Append() error = nil; want an error for a read-only sink")
+	}
+}
+
+func TestLedgerRecordsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "overloaded")
+	}))
+	defer server.Close()
+
+	ledger := deepseek.NewLedger(deepseek.NewMemorySink())
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL), deepseek.WithLedger(ledger))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{Model: deepseek.DeepSeekChat})
+	if stream.Next() {
+		t.Fatalf("Next() = true; want false")
+	}
+	if err := stream.Err(); err == nil || !strings.Contains(err.Error(), "service unavailable") {
+		t.Errorf("Err() = %v; want service unavailable", err)
+	}
+
+	totals, err := ledger.Totals(deepseek.LedgerQuery{})
+	if err != nil {
+		t.Fatalf("Totals() error = %v", err)
+	}
+	if totals.Requests != 1 || totals.Errors != 1 || totals.PromptTokens != 0 || totals.Cost.USD != 0 {
+		t.Errorf("Totals() = %+v; want one failed request without usage", totals)
+	}
+}
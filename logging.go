@@ -0,0 +1,131 @@
+package deepseek
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// chatLogger logs the lifecycle of chat completions, see WithLogger.
+type chatLogger struct {
+	logger *slog.Logger
+
+	// content logs the messages and completions at debug level, truncated to maxContentLength runes when positive.
+	content          bool
+	maxContentLength int
+}
+
+func (l chatLogger) middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				l.started(ctx, "chat completion started", args.Model, args.Messages)
+				start := time.Now()
+				completion, err := next.CreateCompletion(ctx, args)
+				l.finished(ctx, "chat completion", args.Model, completion, err, time.Since(start))
+				return completion, err
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				l.started(ctx, "chat stream started", args.Model, args.Messages)
+				start := time.Now()
+				stream := next.CreateStreamCompletion(ctx, args)
+
+				var acc StreamAccumulator
+				var chunks int
+				stream.OnChunk(func(chunk StreamCompletionChunk) {
+					if chunks == 0 {
+						l.logger.LogAttrs(ctx, slog.LevelDebug, "chat stream first chunk",
+							slog.String("model", string(args.Model)),
+							slog.Duration("ttft", time.Since(start)),
+						)
+					}
+					chunks++
+					acc.Add(chunk)
+				})
+				stream.OnDone(func(err error) {
+					var completion *CompletionResponse
+					if chunks > 0 {
+						response := acc.Response()
+						completion = &response
+					}
+					l.finished(ctx, "chat stream", args.Model, completion, err, time.Since(start), slog.Int("chunks", chunks))
+				})
+				return stream
+			},
+		}
+	}
+}
+
+func (l chatLogger) started(ctx context.Context, msg string, model ModelID, messages []Message) {
+	if !l.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("model", string(model)),
+		slog.Int("messages", len(messages)),
+	}
+	if tags := TagsFromContext(ctx); len(tags) > 0 {
+		attrs = append(attrs, slog.Any("tags", tags))
+	}
+	if l.content {
+		contents := make([]slog.Attr, len(messages))
+		for i, message := range messages {
+			contents[i] = slog.String(string(message.Role), l.truncate(message.Content))
+		}
+		attrs = append(attrs, slog.Attr{Key: "content", Value: slog.GroupValue(contents...)})
+	}
+	l.logger.LogAttrs(ctx, slog.LevelDebug, msg, attrs...)
+}
+
+// finished logs the end of a completion, at info level when it succeeded and at error level otherwise.
+func (l chatLogger) finished(ctx context.Context, msg string, model ModelID, completion *CompletionResponse, err error, latency time.Duration, extra ...slog.Attr) {
+	level, outcome := slog.LevelInfo, " finished"
+	if err != nil {
+		level, outcome = slog.LevelError, " failed"
+	}
+	msg += outcome
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("model", string(model)),
+		slog.Duration("latency", latency),
+	}
+	attrs = append(attrs, extra...)
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	if completion != nil {
+		if completion.ServedBy != "" {
+			attrs = append(attrs, slog.String("served_by", completion.ServedBy))
+		}
+		if len(completion.Choices) > 0 && completion.Choices[0].FinishReason != "" {
+			attrs = append(attrs, slog.String("finish_reason", string(completion.Choices[0].FinishReason)))
+		}
+		if usage := completion.Usage; usage.TotalTokens > 0 {
+			attrs = append(attrs, slog.Group("usage",
+				slog.Int64("prompt_tokens", usage.PromptTokens),
+				slog.Int64("completion_tokens", usage.CompletionTokens),
+				slog.Int64("total_tokens", usage.TotalTokens),
+			))
+		}
+		if l.content && len(completion.Choices) > 0 && l.logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.String("content", l.truncate(completion.Choices[0].Message.Content)))
+		}
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// truncate shortens content to the maximum length, marking the cut with an ellipsis.
+func (l chatLogger) truncate(content string) string {
+	if l.maxContentLength <= 0 || utf8.RuneCountInString(content) <= l.maxContentLength {
+		return content
+	}
+	runes := []rune(content)
+	return string(runes[:l.maxContentLength]) + "…"
+}
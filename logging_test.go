@@ -0,0 +1,151 @@
+package deepseek_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+// logRecords decodes the records of a JSON log.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func findRecord(records []map[string]any, msg string) map[string]any {
+	for _, record := range records {
+		if record["msg"] == msg {
+			return record
+		}
+	}
+	return nil
+}
+
+func TestWithLogger(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(deepseektest.Text(deepseek.DeepSeekChat, "The secret is safe"))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := deepseek.NewClient("sk-secret-key", deepseek.WithBaseURL(server.URL), deepseek.WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := deepseek.WithRequestHeader(context.Background(), "Cookie", "session=secret-cookie")
+	ctx = deepseek.WithRequestHeader(ctx, "x-api-key", "secret-gateway-key")
+	if _, err := client.Chats.CreateCompletion(ctx, deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Tell me the secret"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"sk-secret-key", "secret is safe", "secret-cookie", "secret-gateway-key"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("log leaks %q:\n%s", secret, buf.String())
+		}
+	}
+	records := logRecords(t, &buf)
+	request := findRecord(records, "http request")
+	if request == nil || request["level"] != "DEBUG" || request["status"] != float64(http.StatusOK) {
+		t.Fatalf("http request record = %v", request)
+	}
+	header := request["header"].(map[string]any)
+	for _, key := range []string{"Authorization", "Cookie", "X-Api-Key"} {
+		if header[key] != "[REDACTED]" {
+			t.Errorf("%s header = %v; want it redacted", key, header[key])
+		}
+	}
+	finished := findRecord(records, "chat completion finished")
+	if finished == nil || finished["level"] != "INFO" || finished["model"] != string(deepseek.DeepSeekChat) {
+		t.Fatalf("finished record = %v", finished)
+	}
+	if usage := finished["usage"].(map[string]any); usage["total_tokens"] != float64(14) {
+		t.Errorf("usage = %v", usage)
+	}
+}
+
+func TestWithLoggerFailure(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(deepseektest.Error(http.StatusServiceUnavailable, "overloaded"))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	records := logRecords(t, &buf)
+	if request := findRecord(records, "http request"); request == nil || request["level"] != "WARN" || request["status"] != float64(http.StatusServiceUnavailable) {
+		t.Errorf("http request record = %v", request)
+	}
+	if failed := findRecord(records, "chat completion failed"); failed == nil || failed["level"] != "ERROR" || !strings.Contains(failed["error"].(string), "service unavailable") {
+		t.Errorf("failed record = %v", failed)
+	}
+}
+
+func TestWithLogContent(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(deepseektest.Text(deepseek.DeepSeekChat, "Hello there, how are you?"))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithLogger(logger), deepseek.WithLogContent(11))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	for stream.Next() {
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	records := logRecords(t, &buf)
+	started := findRecord(records, "chat stream started")
+	if started == nil || started["content"].(map[string]any)["user"] != "Hello" {
+		t.Errorf("started record = %v", started)
+	}
+	if first := findRecord(records, "chat stream first chunk"); first == nil || first["ttft"] == nil {
+		t.Errorf("first chunk record = %v", first)
+	}
+	finished := findRecord(records, "chat stream finished")
+	if finished == nil || finished["content"] != "Hello there…" || finished["chunks"] == float64(0) {
+		t.Errorf("finished record = %v", finished)
+	}
+}
+
+func TestWithLogContentWithoutLogger(t *testing.T) {
+	if _, err := deepseek.NewClient("sk-test", deepseek.WithLogContent(0)); err == nil {
+		t.Error("NewClient() error = nil; want an error without a logger")
+	}
+}
@@ -0,0 +1,219 @@
+package deepseek
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// ErrorKind classifies the errors of completions for metrics.
+type ErrorKind string
+
+const (
+	ErrorKindInvalidFormat        ErrorKind = "invalid_format"
+	ErrorKindAuthenticationFailed ErrorKind = "authentication_failed"
+	ErrorKindInsufficientBalance  ErrorKind = "insufficient_balance"
+	ErrorKindNotFound             ErrorKind = "not_found"
+	ErrorKindInvalidParameters    ErrorKind = "invalid_parameters"
+	ErrorKindRateLimitExceeded    ErrorKind = "rate_limit_exceeded"
+	ErrorKindServer               ErrorKind = "server_error"
+	ErrorKindServiceUnavailable   ErrorKind = "service_unavailable"
+	ErrorKindCircuitOpen          ErrorKind = "circuit_open"
+	ErrorKindTimeout              ErrorKind = "timeout"
+	ErrorKindCanceled             ErrorKind = "canceled"
+	ErrorKindOther                ErrorKind = "other"
+)
+
+// ErrorKindOf returns the kind of err, matching the errors returned by the API first.
+func ErrorKindOf(err error) ErrorKind {
+	kinds := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{ErrInvalidFormat, ErrorKindInvalidFormat},
+		{ErrAuthenticationFailed, ErrorKindAuthenticationFailed},
+		{ErrInsufficientBalance, ErrorKindInsufficientBalance},
+		{ErrNotFound, ErrorKindNotFound},
+		{ErrInvalidParameters, ErrorKindInvalidParameters},
+		{ErrRateLimitExceeded, ErrorKindRateLimitExceeded},
+		{ErrServer, ErrorKindServer},
+		{ErrServiceUnavailable, ErrorKindServiceUnavailable},
+		{context.DeadlineExceeded, ErrorKindTimeout},
+		{context.Canceled, ErrorKindCanceled},
+	}
+	for _, k := range kinds {
+		if errors.Is(err, k.err) {
+			return k.kind
+		}
+	}
+	var open *ErrCircuitOpen
+	if errors.As(err, &open) {
+		return ErrorKindCircuitOpen
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorKindTimeout
+	}
+	return ErrorKindOther
+}
+
+// MetricsRecorder receives the metrics of chat completions, see WithMetrics. It must be safe for concurrent use.
+type MetricsRecorder interface {
+	// ObserveDuration is called with the duration of every completion, from its request to its last chunk for streams.
+	ObserveDuration(model ModelID, stream bool, duration time.Duration)
+
+	// ObserveTimeToFirstToken is called with the delay before the first chunk of a stream.
+	ObserveTimeToFirstToken(model ModelID, ttft time.Duration)
+
+	// ObserveInterTokenLatency is called with the delay between consecutive chunks of a stream.
+	ObserveInterTokenLatency(model ModelID, latency time.Duration)
+
+	// ObserveTokensPerSecond is called with the output rate of every successful completion, measured from the first
+	// chunk for streams.
+	ObserveTokensPerSecond(model ModelID, tokensPerSecond float64)
+
+	// AddUsage is called with the usage of every successful completion, estimated for streams without usage.
+	AddUsage(model ModelID, usage CompletionUsage)
+
+	// AddError is called with the kind of the error of every failed completion.
+	AddError(model ModelID, kind ErrorKind)
+}
+
+// MetricsMiddleware returns a middleware reporting the metrics of the completions to the recorder.
+func MetricsMiddleware(recorder MetricsRecorder) ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				start := time.Now()
+				completion, err := next.CreateCompletion(ctx, args)
+				duration := time.Since(start)
+				recorder.ObserveDuration(args.Model, false, duration)
+				if err != nil {
+					recorder.AddError(args.Model, ErrorKindOf(err))
+					return completion, err
+				}
+				recorder.AddUsage(args.Model, completion.Usage)
+				if seconds := duration.Seconds(); seconds > 0 {
+					recorder.ObserveTokensPerSecond(args.Model, float64(completion.Usage.CompletionTokens)/seconds)
+				}
+				return completion, err
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				start := time.Now()
+				stream := next.CreateStreamCompletion(ctx, args)
+
+				var acc StreamAccumulator
+				var first, last time.Time
+				stream.OnChunk(func(chunk StreamCompletionChunk) {
+					now := time.Now()
+					if first.IsZero() {
+						first = now
+						recorder.ObserveTimeToFirstToken(args.Model, now.Sub(start))
+					} else if len(chunk.Choices) > 0 {
+						// The final chunk carrying the usage isn't a token.
+						recorder.ObserveInterTokenLatency(args.Model, now.Sub(last))
+					}
+					last = now
+					acc.Add(chunk)
+				})
+				stream.OnDone(func(err error) {
+					recorder.ObserveDuration(args.Model, true, time.Since(start))
+					if err != nil {
+						recorder.AddError(args.Model, ErrorKindOf(err))
+						return
+					}
+					usage, ok := acc.Usage()
+					if !ok {
+						usage = estimateStreamUsage(args, &acc)
+					}
+					recorder.AddUsage(args.Model, usage)
+					if seconds := last.Sub(first).Seconds(); seconds > 0 {
+						recorder.ObserveTokensPerSecond(args.Model, float64(usage.CompletionTokens)/seconds)
+					}
+				})
+				return stream
+			},
+		}
+	}
+}
+
+// ExpvarMetrics is a MetricsRecorder publishing the metrics with expvar, e.g. on /debug/vars. Metrics are grouped by
+// model: durations are published as totals in milliseconds with their count, and tokens per second as the last value.
+type ExpvarMetrics struct {
+	root *expvar.Map
+
+	mu     sync.Mutex
+	models map[ModelID]*expvar.Map
+}
+
+// NewExpvarMetrics creates a recorder publishing the metrics under the given name. Like expvar.Publish, it panics if
+// the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	return NewExpvarMetricsMap(expvar.NewMap(name))
+}
+
+// NewExpvarMetricsMap creates a recorder publishing the metrics in m, e.g. a map nested in the variables of an
+// application or one left unpublished.
+func NewExpvarMetricsMap(m *expvar.Map) *ExpvarMetrics {
+	return &ExpvarMetrics{root: m, models: make(map[ModelID]*expvar.Map)}
+}
+
+// model returns the metrics of a model, published on first use.
+func (m *ExpvarMetrics) model(model ModelID) *expvar.Map {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metrics, ok := m.models[model]
+	if !ok {
+		metrics = new(expvar.Map).Init()
+		metrics.Set("errors", new(expvar.Map).Init())
+		m.models[model] = metrics
+		m.root.Set(string(model), metrics)
+	}
+	return metrics
+}
+
+func (m *ExpvarMetrics) observe(model ModelID, name string, d time.Duration) {
+	metrics := m.model(model)
+	metrics.Add(name+"_count", 1)
+	metrics.AddFloat(name+"_ms_total", float64(d)/float64(time.Millisecond))
+}
+
+func (m *ExpvarMetrics) ObserveDuration(model ModelID, stream bool, duration time.Duration) {
+	m.model(model).Add("requests", 1)
+	if stream {
+		m.model(model).Add("streams", 1)
+	}
+	m.observe(model, "duration", duration)
+}
+
+func (m *ExpvarMetrics) ObserveTimeToFirstToken(model ModelID, ttft time.Duration) {
+	m.observe(model, "ttft", ttft)
+}
+
+func (m *ExpvarMetrics) ObserveInterTokenLatency(model ModelID, latency time.Duration) {
+	m.observe(model, "inter_token_latency", latency)
+}
+
+func (m *ExpvarMetrics) ObserveTokensPerSecond(model ModelID, tokensPerSecond float64) {
+	tps := new(expvar.Float)
+	tps.Set(tokensPerSecond)
+	m.model(model).Set("tokens_per_second", tps)
+}
+
+func (m *ExpvarMetrics) AddUsage(model ModelID, usage CompletionUsage) {
+	metrics := m.model(model)
+	metrics.Add("prompt_tokens", usage.PromptTokens)
+	metrics.Add("prompt_cache_hit_tokens", usage.PromptCacheHitTokens)
+	metrics.Add("completion_tokens", usage.CompletionTokens)
+	metrics.Add("reasoning_tokens", usage.CompletionTokensDetails.ReasoningTokens)
+}
+
+func (m *ExpvarMetrics) AddError(model ModelID, kind ErrorKind) {
+	m.model(model).Get("errors").(*expvar.Map).Add(string(kind), 1)
+}
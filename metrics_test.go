@@ -0,0 +1,205 @@
+package deepseek_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+type recordedMetrics struct {
+	mu           sync.Mutex
+	durations    int
+	ttfts        int
+	interTokens  int
+	tokensPerSec []float64
+	usage        deepseek.CompletionUsage
+	errors       []deepseek.ErrorKind
+}
+
+func (r *recordedMetrics) ObserveDuration(model deepseek.ModelID, stream bool, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.durations++
+}
+
+func (r *recordedMetrics) ObserveTimeToFirstToken(model deepseek.ModelID, ttft time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ttfts++
+}
+
+func (r *recordedMetrics) ObserveInterTokenLatency(model deepseek.ModelID, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interTokens++
+}
+
+func (r *recordedMetrics) ObserveTokensPerSecond(model deepseek.ModelID, tokensPerSecond float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokensPerSec = append(r.tokensPerSec, tokensPerSecond)
+}
+
+func (r *recordedMetrics) AddUsage(model deepseek.ModelID, usage deepseek.CompletionUsage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.usage.PromptTokens += usage.PromptTokens
+	r.usage.CompletionTokens += usage.CompletionTokens
+}
+
+func (r *recordedMetrics) AddError(model deepseek.ModelID, kind deepseek.ErrorKind) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, kind)
+}
+
+func TestWithMetrics(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	server.Enqueue(
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello there!"),
+		deepseektest.Error(http.StatusTooManyRequests, "slow down"),
+		deepseektest.Stream(deepseektest.StreamScript{
+			Chunks: deepseektest.Chunks(deepseek.CompletionResponse{Model: deepseek.DeepSeekChat, Choices: []deepseek.CompletionChoice{
+				{Index: 0, Message: deepseek.Message{Role: deepseek.AssistantRole, Content: "One"}},
+				{Index: 1, Message: deepseek.Message{Role: deepseek.AssistantRole, Content: "Two"}},
+			}}),
+			Delay: 5 * time.Millisecond,
+		}),
+	)
+
+	recorder := &recordedMetrics{}
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	}
+
+	if _, err := client.Chats.CreateCompletion(context.Background(), args); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Chats.CreateCompletion(context.Background(), args); !errors.Is(err, deepseek.ErrRateLimitExceeded) {
+		t.Fatalf("error = %v; want ErrRateLimitExceeded", err)
+	}
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{Model: args.Model, Messages: args.Messages})
+	for stream.Next() {
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.durations != 3 || recorder.ttfts != 1 || recorder.interTokens != 1 {
+		t.Errorf("durations = %d, ttfts = %d, inter-token latencies = %d; want 3, 1, 1", recorder.durations, recorder.ttfts, recorder.interTokens)
+	}
+	if len(recorder.tokensPerSec) != 2 {
+		t.Errorf("tokens per second = %v; want one per successful completion", recorder.tokensPerSec)
+	}
+	if recorder.usage.CompletionTokens < 4 {
+		t.Errorf("usage = %+v; want the completions and the estimated stream", recorder.usage)
+	}
+	if len(recorder.errors) != 1 || recorder.errors[0] != deepseek.ErrorKindRateLimitExceeded {
+		t.Errorf("errors = %v", recorder.errors)
+	}
+}
+
+func TestWithMetricsSingleflight(t *testing.T) {
+	gate := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-gate
+		fmt.Fprint(w, `{"id":"1","model":"deepseek-chat","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"}}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+	}))
+	defer server.Close()
+
+	recorder := &recordedMetrics{}
+	client, err := deepseek.NewClient("sk-test", deepseek.WithBaseURL(server.URL), deepseek.WithSingleflight(), deepseek.WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	}
+
+	// The shared request is measured once, however many callers wait for it.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Chats.CreateCompletion(context.Background(), args); err != nil {
+				t.Errorf("CreateCompletion() error = %v", err)
+			}
+		}()
+	}
+	waitFor(t, func() bool { return client.Singleflight.Stats().Shared == 2 })
+	close(gate)
+	wg.Wait()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.durations != 1 || recorder.usage.PromptTokens != 10 || recorder.usage.CompletionTokens != 5 {
+		t.Errorf("durations = %d, usage = %+v; want the shared request once", recorder.durations, recorder.usage)
+	}
+}
+
+func TestErrorKindOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want deepseek.ErrorKind
+	}{
+		{fmt.Errorf("%w: bad", deepseek.ErrInvalidFormat), deepseek.ErrorKindInvalidFormat},
+		{fmt.Errorf("%w: no", deepseek.ErrInsufficientBalance), deepseek.ErrorKindInsufficientBalance},
+		{fmt.Errorf("%w: down", deepseek.ErrServiceUnavailable), deepseek.ErrorKindServiceUnavailable},
+		{&deepseek.ErrRateLimited{Resource: "tokens"}, deepseek.ErrorKindRateLimitExceeded},
+		{&deepseek.ErrCircuitOpen{}, deepseek.ErrorKindCircuitOpen},
+		{context.DeadlineExceeded, deepseek.ErrorKindTimeout},
+		{errors.New("boom"), deepseek.ErrorKindOther},
+	}
+	for _, test := range tests {
+		if got := deepseek.ErrorKindOf(test.err); got != test.want {
+			t.Errorf("ErrorKindOf(%v) = %s; want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	// The map isn't published, expvar.Publish panics on the names published by previous runs of the test.
+	root := new(expvar.Map).Init()
+	metrics := deepseek.NewExpvarMetricsMap(root)
+	metrics.ObserveDuration(deepseek.DeepSeekChat, true, 1500*time.Millisecond)
+	metrics.ObserveTimeToFirstToken(deepseek.DeepSeekChat, 200*time.Millisecond)
+	metrics.ObserveTokensPerSecond(deepseek.DeepSeekChat, 42)
+	metrics.AddUsage(deepseek.DeepSeekChat, deepseek.CompletionUsage{PromptTokens: 10, CompletionTokens: 63})
+	metrics.AddError(deepseek.DeepSeekReasoner, deepseek.ErrorKindServer)
+	metrics.AddError(deepseek.DeepSeekReasoner, deepseek.ErrorKindServer)
+
+	var published map[string]map[string]any
+	if err := json.Unmarshal([]byte(root.String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	chat := published[string(deepseek.DeepSeekChat)]
+	if chat["requests"] != float64(1) || chat["streams"] != float64(1) || chat["duration_ms_total"] != float64(1500) {
+		t.Errorf("chat metrics = %v", chat)
+	}
+	if chat["ttft_count"] != float64(1) || chat["tokens_per_second"] != float64(42) || chat["completion_tokens"] != float64(63) {
+		t.Errorf("chat metrics = %v", chat)
+	}
+	if errs := published[string(deepseek.DeepSeekReasoner)]["errors"].(map[string]any); errs["server_error"] != float64(2) {
+		t.Errorf("reasoner errors = %v", errs)
+	}
+}
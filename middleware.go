@@ -0,0 +1,79 @@
+package deepseek
+
+import (
+	"context"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// ChatMiddleware decorates a ChatService, e.g. to add caching, metrics or access control.
+type ChatMiddleware func(next ChatService) ChatService
+
+// ChatChain composes chat middlewares. The first middleware is the outermost one.
+type ChatChain []ChatMiddleware
+
+// NewChatChain creates a chain of middlewares.
+func NewChatChain(middlewares ...ChatMiddleware) ChatChain {
+	return append(ChatChain(nil), middlewares...)
+}
+
+// Append returns a new chain with the middlewares added after the middlewares of the chain.
+func (c ChatChain) Append(middlewares ...ChatMiddleware) ChatChain {
+	chain := make(ChatChain, 0, len(c)+len(middlewares))
+	chain = append(chain, c...)
+	return append(chain, middlewares...)
+}
+
+// Then decorates the service with the middlewares of the chain.
+func (c ChatChain) Then(service ChatService) ChatService {
+	for i := len(c) - 1; i >= 0; i-- {
+		service = c[i](service)
+	}
+	return service
+}
+
+// ChatFuncs implements a ChatService with functions, delegating to Next the calls without a function.
+//
+// It makes middlewares concerned with only one kind of completion short to write.
+type ChatFuncs struct {
+	Next ChatService
+
+	CompleteFunc func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error)
+
+	StreamFunc func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk]
+}
+
+func (f ChatFuncs) CreateCompletion(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+	if f.CompleteFunc != nil {
+		return f.CompleteFunc(ctx, args)
+	}
+	return f.Next.CreateCompletion(ctx, args)
+}
+
+func (f ChatFuncs) CreateStreamCompletion(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+	if f.StreamFunc != nil {
+		return f.StreamFunc(ctx, args)
+	}
+	return f.Next.CreateStreamCompletion(ctx, args)
+}
+
+// checkMiddleware rejects the requests for which check returns an error before they reach the next service.
+func checkMiddleware(check func(ctx context.Context, model ModelID) error) ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				if err := check(ctx, args.Model); err != nil {
+					return nil, err
+				}
+				return next.CreateCompletion(ctx, args)
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				if err := check(ctx, args.Model); err != nil {
+					return ssestream.NewStream[StreamCompletionChunk](nil, err)
+				}
+				return next.CreateStreamCompletion(ctx, args)
+			},
+		}
+	}
+}
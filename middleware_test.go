@@ -0,0 +1,106 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// fakeChats is a ChatService answering every completion with the same content.
+type fakeChats struct {
+	content string
+	err     error
+}
+
+func (f *fakeChats) CreateCompletion(ctx context.Context, args deepseek.CompletionArgs) (*deepseek.CompletionResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &deepseek.CompletionResponse{
+		Model:   args.Model,
+		Choices: []deepseek.CompletionChoice{{Message: deepseek.Message{Role: deepseek.AssistantRole, Content: f.content}}},
+	}, nil
+}
+
+func (f *fakeChats) CreateStreamCompletion(ctx context.Context, args deepseek.StreamCompletionArgs) *ssestream.Stream[deepseek.StreamCompletionChunk] {
+	return ssestream.NewStream[deepseek.StreamCompletionChunk](nil, f.err)
+}
+
+func tracing(name string, calls *[]string) deepseek.ChatMiddleware {
+	return func(next deepseek.ChatService) deepseek.ChatService {
+		return deepseek.ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args deepseek.CompletionArgs) (*deepseek.CompletionResponse, error) {
+				*calls = append(*calls, name)
+				return next.CreateCompletion(ctx, args)
+			},
+		}
+	}
+}
+
+func TestChatChain(t *testing.T) {
+	var calls []string
+	chain := deepseek.NewChatChain(tracing("outer", &calls)).Append(tracing("inner", &calls))
+	chats := chain.Then(&fakeChats{content: "Hello!"})
+
+	completion, err := chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat})
+	if err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	if got := completion.Choices[0].Message.Content; got != "Hello!" {
+		t.Errorf("Content = %q; want %q", got, "Hello!")
+	}
+	if want := []string{"outer", "inner"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v; want %v", calls, want)
+	}
+
+	// Streams go straight to the service since the middlewares have no StreamFunc.
+	stream := chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{Model: deepseek.DeepSeekChat})
+	if stream.Next() || stream.Err() != nil {
+		t.Errorf("stream Next() = true or Err() = %v; want an empty stream", stream.Err())
+	}
+	if len(calls) != 2 {
+		t.Errorf("calls = %v; want the stream to bypass the middlewares", calls)
+	}
+}
+
+func TestClientWithMockServices(t *testing.T) {
+	unavailable := &fakeChats{err: deepseek.ErrServiceUnavailable}
+	ledger := deepseek.NewLedger(deepseek.NewMemorySink())
+	client := &deepseek.Client{Chats: ledger.Middleware()(unavailable)}
+
+	_, err := client.Chats.CreateCompletion(deepseek.WithTags(context.Background(), "mock"), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat})
+	if !errors.Is(err, deepseek.ErrServiceUnavailable) {
+		t.Fatalf("CreateCompletion() error = %v; want ErrServiceUnavailable", err)
+	}
+
+	records, err := ledger.Records(deepseek.LedgerQuery{Tag: "mock"})
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(records) != 1 || records[0].Error == "" {
+		t.Errorf("Records() = %+v; want one failed record", records)
+	}
+}
+
+func TestWithChatMiddleware(t *testing.T) {
+	server := newCompletionServer(t)
+	var calls []string
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL),
+		deepseek.WithChatMiddleware(tracing("first", &calls), tracing("second", &calls)),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat}); err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v; want %v", calls, want)
+	}
+}
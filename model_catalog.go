@@ -0,0 +1,244 @@
+package deepseek
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ModelCatalogDiff lists the models added and removed between two snapshots of the catalog.
+type ModelCatalogDiff struct {
+	Added   []Model
+	Removed []Model
+}
+
+// Empty reports whether the snapshots are identical.
+func (d ModelCatalogDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+type ModelCatalogConfig struct {
+	// TTL is how long the list of models is cached. Defaults to 1 hour.
+	TTL time.Duration
+
+	// RejectUnknown makes clients configured WithModelCatalog reject requests for models missing from the catalog with ErrModelNotFound.
+	RejectUnknown bool
+
+	// OnChange is called when a refresh finds added or removed models.
+	OnChange func(diff ModelCatalogDiff)
+
+	// RetryInterval is how long refreshes in the background of requests are suspended after one fails. Defaults to 1
+	// minute.
+	RetryInterval time.Duration
+
+	// OnError is called by Run and by refreshes in the background of requests when a refresh fails.
+	OnError func(err error)
+
+	// Clock defaults to SystemClock.
+	Clock Clock
+}
+
+// ModelCatalog caches the models available to the account and tracks their changes.
+type ModelCatalog struct {
+	models ModelLister
+	config ModelCatalogConfig
+
+	mu        sync.RWMutex
+	snapshot  map[string]Model
+	fetchedAt time.Time
+
+	// refreshing is closed when the refresh started in the background of a request completes, nil when none is running.
+	refreshing chan struct{}
+	// err and failedAt are the error and time of the last refresh in the background of a request.
+	err      error
+	failedAt time.Time
+
+	// refreshMu serializes refreshes so concurrent callers of an expired catalog share a single request.
+	refreshMu sync.Mutex
+}
+
+// NewModelCatalog creates a model catalog. It is loaded on first use, call Run to refresh it in the background.
+func NewModelCatalog(models ModelLister, config ModelCatalogConfig) *ModelCatalog {
+	if config.TTL <= 0 {
+		config.TTL = time.Hour
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Minute
+	}
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+	return &ModelCatalog{models: models, config: config}
+}
+
+// Run refreshes the catalog every TTL until ctx is done.
+func (c *ModelCatalog) Run(ctx context.Context) {
+	for {
+		if _, err := c.Refresh(); err != nil && c.config.OnError != nil {
+			c.config.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.config.Clock.After(c.config.TTL):
+		}
+	}
+}
+
+// Refresh lists the models and returns the changes since the previous snapshot. The first snapshot reports no changes.
+func (c *ModelCatalog) Refresh() (ModelCatalogDiff, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.refresh()
+}
+
+func (c *ModelCatalog) refresh() (ModelCatalogDiff, error) {
+	list, err := c.models.ListModels()
+	if err != nil {
+		return ModelCatalogDiff{}, err
+	}
+
+	snapshot := make(map[string]Model, len(list.Data))
+	for _, model := range list.Data {
+		snapshot[model.ID] = model
+	}
+
+	c.mu.Lock()
+	previous := c.snapshot
+	c.snapshot = snapshot
+	c.fetchedAt = c.config.Clock.Now()
+	c.mu.Unlock()
+
+	var diff ModelCatalogDiff
+	if previous == nil {
+		return diff, nil
+	}
+	for id, model := range snapshot {
+		if _, ok := previous[id]; !ok {
+			diff.Added = append(diff.Added, model)
+		}
+	}
+	for id, model := range previous {
+		if _, ok := snapshot[id]; !ok {
+			diff.Removed = append(diff.Removed, model)
+		}
+	}
+	sortModels(diff.Added)
+	sortModels(diff.Removed)
+
+	if !diff.Empty() && c.config.OnChange != nil {
+		c.config.OnChange(diff)
+	}
+	return diff, nil
+}
+
+// Models returns the models available to the account. See Has for how the catalog is loaded and refreshed.
+func (c *ModelCatalog) Models(ctx context.Context) ([]Model, error) {
+	if err := c.ensureFresh(ctx); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	models := make([]Model, 0, len(c.snapshot))
+	for _, model := range c.snapshot {
+		models = append(models, model)
+	}
+	sortModels(models)
+	return models, nil
+}
+
+// Has reports whether the model is available to the account.
+//
+// The first call waits for the catalog to load until ctx is done. An expired catalog keeps being used while it is
+// refreshed in the background. After a refresh fails, the next one is attempted after RetryInterval.
+func (c *ModelCatalog) Has(ctx context.Context, id ModelID) (bool, error) {
+	if err := c.ensureFresh(ctx); err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.snapshot[string(id)]
+	return ok, nil
+}
+
+// Check returns ErrModelNotFound when the model isn't available to the account.
+//
+// Models can't be checked while the catalog fails to load, in which case Check lets them through.
+func (c *ModelCatalog) Check(ctx context.Context, id ModelID) error {
+	ok, err := c.Has(ctx, id)
+	if err != nil || ok {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrModelNotFound, id)
+}
+
+// ensureFresh starts a refresh in the background when the catalog was never loaded or its TTL expired, unless the
+// last one failed less than RetryInterval ago. It only waits for the refresh when the catalog was never loaded.
+func (c *ModelCatalog) ensureFresh(ctx context.Context) error {
+	now := c.config.Clock.Now()
+	c.mu.Lock()
+	loaded := c.snapshot != nil
+	if loaded && now.Sub(c.fetchedAt) < c.config.TTL {
+		c.mu.Unlock()
+		return nil
+	}
+	if c.refreshing == nil && (c.err == nil || now.Sub(c.failedAt) >= c.config.RetryInterval) {
+		c.refreshing = make(chan struct{})
+		go c.refreshInBackground(c.refreshing)
+	}
+	refreshing, err := c.refreshing, c.err
+	c.mu.Unlock()
+
+	if loaded {
+		return nil
+	}
+	if refreshing == nil {
+		return err
+	}
+	select {
+	case <-refreshing:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.snapshot == nil {
+		return c.err
+	}
+	return nil
+}
+
+func (c *ModelCatalog) refreshInBackground(done chan struct{}) {
+	_, err := c.Refresh()
+
+	c.mu.Lock()
+	c.refreshing = nil
+	c.err = err
+	if err != nil {
+		c.failedAt = c.config.Clock.Now()
+	}
+	c.mu.Unlock()
+	close(done)
+
+	if err != nil && c.config.OnError != nil {
+		c.config.OnError(err)
+	}
+}
+
+// Middleware returns a middleware rejecting completions for models missing from the catalog with ErrModelNotFound.
+func (c *ModelCatalog) Middleware() ChatMiddleware {
+	return checkMiddleware(func(ctx context.Context, model ModelID) error {
+		return c.Check(ctx, model)
+	})
+}
+
+func sortModels(models []Model) {
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+}
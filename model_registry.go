@@ -0,0 +1,214 @@
+package deepseek
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrUnsupportedFeature = errors.New("unsupported feature")
+
+// ModelFeature is a set of optional features supported by a model.
+type ModelFeature uint
+
+const (
+	// FeatureTools is function calling with Tools.
+	FeatureTools ModelFeature = 1 << iota
+	// FeatureJSONMode is JSON output with ResponseFormatJson.
+	FeatureJSONMode
+	// FeatureFIM is fill-in-the-middle completion.
+	FeatureFIM
+	// FeaturePrefixCompletion is completion of an assistant message prefix.
+	FeaturePrefixCompletion
+	// FeatureLogprobs is log probabilities of output tokens.
+	FeatureLogprobs
+	// FeatureReasoning is the output of reasoning content before the answer.
+	FeatureReasoning
+)
+
+var featureNames = []struct {
+	feature ModelFeature
+	name    string
+}{
+	{FeatureTools, "tools"},
+	{FeatureJSONMode, "json_mode"},
+	{FeatureFIM, "fim"},
+	{FeaturePrefixCompletion, "prefix_completion"},
+	{FeatureLogprobs, "logprobs"},
+	{FeatureReasoning, "reasoning"},
+}
+
+func (f ModelFeature) String() string {
+	var names []string
+	for _, fn := range featureNames {
+		if f&fn.feature != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// ModelInfo describes the limits and capabilities of a model.
+type ModelInfo struct {
+	// ID is the ID of the model.
+	ID ModelID
+
+	// ContextWindow is the maximum number of prompt and completion tokens.
+	ContextWindow int64
+
+	// MaxOutputTokens is the maximum value of MaxTokens.
+	MaxOutputTokens int64
+
+	// DefaultMaxTokens is the number of tokens generated when MaxTokens isn't set.
+	DefaultMaxTokens int64
+
+	// Features are the optional features supported by the model.
+	Features ModelFeature
+}
+
+// Supports reports whether the model supports all the given features.
+func (m ModelInfo) Supports(features ModelFeature) bool {
+	return m.Features&features == features
+}
+
+// ModelRegistry describes the known models. It is safe for concurrent use.
+type ModelRegistry struct {
+	mu     sync.RWMutex
+	models map[ModelID]ModelInfo
+}
+
+// DefaultModels describes the models documented at https://api-docs.deepseek.com. Use Register to describe new or self-hosted models.
+var DefaultModels = NewModelRegistry(
+	ModelInfo{
+		ID:               DeepSeekChat,
+		ContextWindow:    65536,
+		MaxOutputTokens:  8192,
+		DefaultMaxTokens: 4096,
+		Features:         FeatureTools | FeatureJSONMode | FeatureFIM | FeaturePrefixCompletion | FeatureLogprobs,
+	},
+	ModelInfo{
+		ID:               DeepSeekCoder,
+		ContextWindow:    65536,
+		MaxOutputTokens:  8192,
+		DefaultMaxTokens: 4096,
+		Features:         FeatureTools | FeatureJSONMode | FeatureFIM | FeaturePrefixCompletion | FeatureLogprobs,
+	},
+	ModelInfo{
+		ID:               DeepSeekReasoner,
+		ContextWindow:    65536,
+		MaxOutputTokens:  8192,
+		DefaultMaxTokens: 4096,
+		Features:         FeaturePrefixCompletion | FeatureReasoning,
+	},
+)
+
+// NewModelRegistry creates a registry describing the given models.
+func NewModelRegistry(models ...ModelInfo) *ModelRegistry {
+	r := &ModelRegistry{models: make(map[ModelID]ModelInfo, len(models))}
+	for _, model := range models {
+		r.models[model.ID] = model
+	}
+	return r
+}
+
+// Register adds or overrides the description of a model.
+func (r *ModelRegistry) Register(model ModelInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[model.ID] = model
+}
+
+// Unregister removes the description of a model.
+func (r *ModelRegistry) Unregister(id ModelID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.models, id)
+}
+
+// Lookup returns the description of a model.
+func (r *ModelRegistry) Lookup(id ModelID) (ModelInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	model, ok := r.models[id]
+	return model, ok
+}
+
+// Models returns the described models sorted by ID.
+func (r *ModelRegistry) Models() []ModelInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	models := make([]ModelInfo, 0, len(r.models))
+	for _, model := range r.models {
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+	return models
+}
+
+// Route returns the model with the smallest context window that supports the features and fits the prompt and completion tokens.
+func (r *ModelRegistry) Route(tokens int64, features ModelFeature) (ModelInfo, bool) {
+	var best ModelInfo
+	var found bool
+	for _, model := range r.Models() {
+		if !model.Supports(features) || model.ContextWindow < tokens {
+			continue
+		}
+		if !found || model.ContextWindow < best.ContextWindow {
+			best, found = model, true
+		}
+	}
+	return best, found
+}
+
+// RegisterModel adds or overrides the description of a model in DefaultModels.
+func RegisterModel(model ModelInfo) {
+	DefaultModels.Register(model)
+}
+
+// LookupModel returns the description of a model from DefaultModels.
+func LookupModel(id ModelID) (ModelInfo, bool) {
+	return DefaultModels.Lookup(id)
+}
+
+// RequiredFeatures returns the optional model features used by the request.
+func (args CompletionArgs) RequiredFeatures() ModelFeature {
+	var features ModelFeature
+	if len(args.Tools) > 0 {
+		features |= FeatureTools
+	}
+	if args.ResponseFormat != nil && args.ResponseFormat.Type == ResponseFormatJson {
+		features |= FeatureJSONMode
+	}
+	if args.Logprobs || args.TopLogprobs > 0 {
+		features |= FeatureLogprobs
+	}
+	return features
+}
+
+// Validate checks the request against the description of its model in DefaultModels: supported features, MaxTokens and context window.
+//
+// Requests for unknown models are not validated.
+func (args CompletionArgs) Validate() error {
+	model, ok := LookupModel(args.Model)
+	if !ok {
+		return nil
+	}
+
+	if missing := args.RequiredFeatures() &^ model.Features; missing != 0 {
+		return fmt.Errorf("%w: model %s doesn't support %s", ErrUnsupportedFeature, model.ID, missing)
+	}
+	if model.MaxOutputTokens > 0 && int64(args.MaxTokens) > model.MaxOutputTokens {
+		return fmt.Errorf("%w: max tokens of %d exceeds the limit of %d for model %s", ErrInvalidParameters, args.MaxTokens, model.MaxOutputTokens, model.ID)
+	}
+	return args.Preflight().Err()
+}
+
+// Validate checks the request against the description of its model in DefaultModels: supported features, MaxTokens and context window.
+func (args StreamCompletionArgs) Validate() error {
+	return args.completionArgs().Validate()
+}
@@ -0,0 +1,91 @@
+package deepseek_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/roushou/deepseek"
+)
+
+func TestModelRegistry(t *testing.T) {
+	registry := deepseek.NewModelRegistry(
+		deepseek.ModelInfo{ID: "small", ContextWindow: 8192, MaxOutputTokens: 2048, Features: deepseek.FeatureTools},
+		deepseek.ModelInfo{ID: "large", ContextWindow: 131072, MaxOutputTokens: 8192, Features: deepseek.FeatureTools | deepseek.FeatureJSONMode},
+	)
+
+	tests := []struct {
+		name     string
+		tokens   int64
+		features deepseek.ModelFeature
+		expected deepseek.ModelID
+		found    bool
+	}{
+		{name: "Short prompt", tokens: 1000, features: deepseek.FeatureTools, expected: "small", found: true},
+		{name: "Long prompt", tokens: 100000, expected: "large", found: true},
+		{name: "JSON mode", tokens: 1000, features: deepseek.FeatureJSONMode, expected: "large", found: true},
+		{name: "Too long", tokens: 200000, found: false},
+		{name: "Unsupported", tokens: 1000, features: deepseek.FeatureFIM, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, found := registry.Route(tt.tokens, tt.features)
+			if found != tt.found || model.ID != tt.expected {
+				t.Errorf("Route() = %s, %t; want %s, %t", model.ID, found, tt.expected, tt.found)
+			}
+		})
+	}
+
+	registry.Unregister("small")
+	if _, ok := registry.Lookup("small"); ok {
+		t.Errorf("Lookup() after Unregister() found the model")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	deepseek.RegisterModel(deepseek.ModelInfo{ID: "self-hosted", ContextWindow: 4096, MaxOutputTokens: 1024, DefaultMaxTokens: 512})
+	t.Cleanup(func() { deepseek.DefaultModels.Unregister("self-hosted") })
+
+	messages := []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}}
+	tests := []struct {
+		name    string
+		args    deepseek.CompletionArgs
+		wantErr error
+	}{
+		{
+			name: "Valid",
+			args: deepseek.CompletionArgs{Model: deepseek.DeepSeekChat, Messages: messages, Tools: []deepseek.Tool{{Type: deepseek.ToolFunctionType}}},
+		},
+		{
+			name:    "Tools with reasoner",
+			args:    deepseek.CompletionArgs{Model: deepseek.DeepSeekReasoner, Messages: messages, Tools: []deepseek.Tool{{Type: deepseek.ToolFunctionType}}},
+			wantErr: deepseek.ErrUnsupportedFeature,
+		},
+		{
+			name:    "Logprobs with reasoner",
+			args:    deepseek.CompletionArgs{Model: deepseek.DeepSeekReasoner, Messages: messages, Logprobs: true},
+			wantErr: deepseek.ErrUnsupportedFeature,
+		},
+		{
+			name:    "Max tokens above the model limit",
+			args:    deepseek.CompletionArgs{Model: "self-hosted", Messages: messages, MaxTokens: 2048},
+			wantErr: deepseek.ErrInvalidParameters,
+		},
+		{
+			name: "Unknown model",
+			args: deepseek.CompletionArgs{Model: "unknown", Messages: messages, Logprobs: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.args.Validate()
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Validate() error = %v; want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
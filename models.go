@@ -1,12 +1,16 @@
 package deepseek
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/roushou/deepseek/internal/http_client"
 )
 
+var ErrModelNotFound = errors.New("model not found")
+
 type ModelID string
 
 const (
@@ -43,13 +47,21 @@ func (c *ModelsClient) ListModels() (*ModelsList, error) {
 }
 
 // GetModel Retrieves a model instance, providing basic information about the model such as the owner and permissioning.
+//
+// It returns ErrModelNotFound when the model doesn't exist.
 func (c *ModelsClient) GetModel(modelID string) (*Model, error) {
 	var model Model
-	path := fmt.Sprintf("/models/%s", modelID)
+	path := fmt.Sprintf("/models/%s", url.PathEscape(modelID))
 	req, err := c.httpClient.NewRequest(http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
 	}
 	_, err = c.httpClient.Do(req, &model)
-	return &model, err
+	if errors.Is(err, http_client.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, modelID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &model, nil
 }
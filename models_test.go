@@ -0,0 +1,182 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func TestGetModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() == "/models/deepseek-chat" {
+			fmt.Fprint(w, `{"id":"deepseek-chat","object":"model","owned_by":"deepseek"}`)
+			return
+		}
+		if r.URL.EscapedPath() != "/models/org%2Fmodel" {
+			t.Errorf("unexpected path %q", r.URL.EscapedPath())
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	model, err := client.Models.GetModel("deepseek-chat")
+	if err != nil || model.ID != "deepseek-chat" {
+		t.Errorf("GetModel() = %+v, %v", model, err)
+	}
+
+	if _, err := client.Models.GetModel("org/model"); !errors.Is(err, deepseek.ErrModelNotFound) {
+		t.Errorf("GetModel() error = %v; want ErrModelNotFound", err)
+	}
+}
+
+func TestModelCatalog(t *testing.T) {
+	var mu sync.Mutex
+	models := []string{"deepseek-chat", "deepseek-reasoner"}
+	var listed atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			listed.Add(1)
+			mu.Lock()
+			defer mu.Unlock()
+			data := make([]string, len(models))
+			for i, id := range models {
+				data[i] = fmt.Sprintf(`{"id":%q,"object":"model","owned_by":"deepseek"}`, id)
+			}
+			fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(data, ","))
+			return
+		}
+		fmt.Fprint(w, `{"id":"1","model":"deepseek-chat","choices":[]}`)
+	}))
+	defer server.Close()
+
+	var diffs []deepseek.ModelCatalogDiff
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL), deepseek.WithModelCatalog(deepseek.ModelCatalogConfig{
+		RejectUnknown: true,
+		OnChange:      func(diff deepseek.ModelCatalogDiff) { diffs = append(diffs, diff) },
+	}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat}); err != nil {
+		t.Errorf("CreateCompletion() error = %v", err)
+	}
+	_, err = client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekCoder})
+	if !errors.Is(err, deepseek.ErrModelNotFound) {
+		t.Errorf("CreateCompletion() error = %v; want ErrModelNotFound", err)
+	}
+	if got := listed.Load(); got != 1 {
+		t.Errorf("models listed %d times; want 1", got)
+	}
+
+	mu.Lock()
+	models = []string{"deepseek-chat", "deepseek-coder"}
+	mu.Unlock()
+	diff, err := client.ModelCatalog.Refresh()
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].ID != "deepseek-coder" || len(diff.Removed) != 1 || diff.Removed[0].ID != "deepseek-reasoner" {
+		t.Errorf("Refresh() diff = %+v", diff)
+	}
+	if len(diffs) != 1 {
+		t.Errorf("OnChange called %d times; want 1", len(diffs))
+	}
+	if _, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekCoder}); err != nil {
+		t.Errorf("CreateCompletion() after refresh error = %v", err)
+	}
+}
+
+func TestModelCatalogRefreshInBackground(t *testing.T) {
+	var listed atomic.Int32
+	var failing, blocking atomic.Bool
+	failing.Store(true)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" {
+			fmt.Fprint(w, `{"id":"1","model":"deepseek-chat","choices":[]}`)
+			return
+		}
+		listed.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if blocking.Load() {
+			<-release
+			fmt.Fprint(w, `{"data":[{"id":"deepseek-chat","object":"model"},{"id":"deepseek-coder","object":"model"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"id":"deepseek-chat","object":"model"}]}`)
+	}))
+	defer server.Close()
+
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	failed := make(chan error, 1)
+	changed := make(chan deepseek.ModelCatalogDiff, 1)
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL), deepseek.WithModelCatalog(deepseek.ModelCatalogConfig{
+		TTL:           time.Hour,
+		RetryInterval: time.Minute,
+		RejectUnknown: true,
+		Clock:         clock,
+		OnError:       func(err error) { failed <- err },
+		OnChange:      func(diff deepseek.ModelCatalogDiff) { changed <- diff },
+	}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	complete := func(model deepseek.ModelID) error {
+		_, err := client.Chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: model})
+		return err
+	}
+
+	// Requests go through while the catalog fails to load, which isn't attempted again before RetryInterval.
+	if err := complete(deepseek.DeepSeekCoder); err != nil {
+		t.Errorf("CreateCompletion() during an outage error = %v", err)
+	}
+	<-failed
+	if err := complete(deepseek.DeepSeekCoder); err != nil {
+		t.Errorf("CreateCompletion() during an outage error = %v", err)
+	}
+	if got := listed.Load(); got != 1 {
+		t.Errorf("models listed %d times during RetryInterval; want 1", got)
+	}
+
+	failing.Store(false)
+	clock.Advance(time.Minute)
+	if err := complete(deepseek.DeepSeekCoder); !errors.Is(err, deepseek.ErrModelNotFound) {
+		t.Errorf("CreateCompletion() after RetryInterval error = %v; want ErrModelNotFound", err)
+	}
+	if got := listed.Load(); got != 2 {
+		t.Errorf("models listed %d times; want 2", got)
+	}
+
+	// An expired catalog is used without waiting for its refresh.
+	blocking.Store(true)
+	clock.Advance(time.Hour)
+	if err := complete(deepseek.DeepSeekCoder); !errors.Is(err, deepseek.ErrModelNotFound) {
+		t.Errorf("CreateCompletion() with an expired catalog error = %v; want ErrModelNotFound", err)
+	}
+	close(release)
+	if diff := <-changed; len(diff.Added) != 1 || diff.Added[0].ID != "deepseek-coder" {
+		t.Errorf("OnChange() diff = %+v", diff)
+	}
+	if err := complete(deepseek.DeepSeekCoder); err != nil {
+		t.Errorf("CreateCompletion() after the refresh error = %v", err)
+	}
+}
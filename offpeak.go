@@ -0,0 +1,294 @@
+package deepseek
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OffPeakConfig configures an OffPeakScheduler.
+type OffPeakConfig struct {
+	// Prices defines the off-peak window. Defaults to DefaultPrices.
+	Prices *PriceTable
+
+	// Clock defaults to SystemClock.
+	Clock Clock
+
+	// RequestsPerMinute paces the jobs by sending at most this many requests per minute. Zero means no limit, all the jobs
+	// being sent at once when the window opens. The pace doesn't depend on the number of jobs or the length of the window,
+	// jobs left when it closes are sent at standard prices.
+	RequestsPerMinute int
+
+	// DeadlineMargin is how long before its deadline a job is sent at standard prices when the off-peak window doesn't
+	// open in time. It should cover the duration of the request. Defaults to 5 minutes.
+	DeadlineMargin time.Duration
+}
+
+// OffPeakStats are statistics of an OffPeakScheduler.
+type OffPeakStats struct {
+	// Pending is the number of jobs held until the off-peak window.
+	Pending int
+
+	// Running is the number of jobs sent and not answered yet.
+	Running int
+
+	// OffPeak is the number of jobs sent during the off-peak window.
+	OffPeak int64
+
+	// Fallback is the number of jobs sent at standard prices to meet their deadline.
+	Fallback int64
+
+	// Canceled is the number of jobs whose context was done before they were sent.
+	Canceled int64
+}
+
+// OffPeakJob is a completion deferred by an OffPeakScheduler.
+type OffPeakJob struct {
+	ctx      context.Context
+	args     CompletionArgs
+	deadline time.Time
+
+	done     chan struct{}
+	unwatch  func() bool
+	sentAt   time.Time
+	offPeak  bool
+	response *CompletionResponse
+	err      error
+}
+
+// Done is closed when the job is completed.
+func (j *OffPeakJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Result waits for the job to complete and returns its completion.
+func (j *OffPeakJob) Result() (*CompletionResponse, error) {
+	<-j.done
+	return j.response, j.err
+}
+
+// SentAt returns when the request of a completed job was sent, zero if it never was.
+func (j *OffPeakJob) SentAt() time.Time {
+	<-j.done
+	return j.sentAt
+}
+
+// OffPeak reports whether the request of a completed job was sent during the off-peak window.
+func (j *OffPeakJob) OffPeak() bool {
+	<-j.done
+	return j.offPeak
+}
+
+func (j *OffPeakJob) finish(response *CompletionResponse, err error) {
+	j.unwatch()
+	j.response, j.err = response, err
+	close(j.done)
+}
+
+// OffPeakScheduler defers completions to the discounted off-peak window of DeepSeek, see PriceTable.NextOffPeak.
+//
+// Jobs are held until the window opens and then sent in deadline order, paced by OffPeakConfig.RequestsPerMinute.
+// A job whose deadline would be missed by waiting for the window is sent at standard prices instead.
+type OffPeakScheduler struct {
+	chats  ChatCompleter
+	config OffPeakConfig
+	wake   chan struct{}
+
+	mu    sync.Mutex
+	jobs  []*OffPeakJob
+	slot  time.Time
+	stats OffPeakStats
+	// stopped is the error of the jobs submitted after Run returned.
+	stopped error
+}
+
+// NewOffPeakScheduler creates a scheduler sending the jobs to chats. It must be started with its Run method.
+func NewOffPeakScheduler(chats ChatCompleter, config OffPeakConfig) *OffPeakScheduler {
+	if config.Prices == nil {
+		config.Prices = DefaultPrices
+	}
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+	if config.DeadlineMargin <= 0 {
+		config.DeadlineMargin = 5 * time.Minute
+	}
+	return &OffPeakScheduler{
+		chats:  chats,
+		config: config,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Submit defers a completion until the off-peak window. The request must complete before deadline, zero meaning no deadline.
+//
+// The job is dropped if ctx is done before it is sent, and ctx is the context of the request once sent. It fails
+// immediately when Run returned.
+func (s *OffPeakScheduler) Submit(ctx context.Context, args CompletionArgs, deadline time.Time) *OffPeakJob {
+	job := &OffPeakJob{ctx: ctx, args: args, deadline: deadline, done: make(chan struct{})}
+	job.unwatch = context.AfterFunc(ctx, s.notify)
+
+	s.mu.Lock()
+	if s.stopped != nil {
+		s.mu.Unlock()
+		job.finish(nil, s.stopped)
+		return job
+	}
+	s.jobs = append(s.jobs, job)
+	s.stats.Pending++
+	s.mu.Unlock()
+
+	s.notify()
+	return job
+}
+
+// CreateCompletion defers a completion until the off-peak window, the deadline of ctx being the deadline of the job.
+//
+// It makes the scheduler usable wherever a ChatCompleter is, e.g. by a BatchRunner.
+func (s *OffPeakScheduler) CreateCompletion(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+	deadline, _ := ctx.Deadline()
+	job := s.Submit(ctx, args, deadline)
+	select {
+	case <-job.Done():
+		return job.Result()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Stats returns the statistics of the scheduler.
+func (s *OffPeakScheduler) Stats() OffPeakStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Run sends the jobs when they are due until ctx is done. The jobs pending then fail, as do the jobs submitted
+// afterwards.
+func (s *OffPeakScheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.stopped = nil
+	s.mu.Unlock()
+
+	for {
+		job, wait := s.next()
+		if job != nil {
+			go s.send(job)
+			continue
+		}
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = s.config.Clock.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			s.stop(fmt.Errorf("off-peak scheduler stopped: %w", ctx.Err()))
+			return
+		case <-s.wake:
+		case <-timer:
+		}
+	}
+}
+
+// next returns the job due now, or how long to wait for the next one. The wait is zero without jobs.
+func (s *OffPeakScheduler) next() (*OffPeakJob, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.config.Clock.Now()
+	jobs := s.jobs[:0]
+	for _, job := range s.jobs {
+		if err := job.ctx.Err(); err != nil {
+			job.finish(nil, err)
+			s.stats.Pending--
+			s.stats.Canceled++
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	clear(s.jobs[len(jobs):])
+	s.jobs = jobs
+	if len(jobs) == 0 {
+		return nil, 0
+	}
+
+	earliest := now
+	if s.slot.After(earliest) {
+		earliest = s.slot
+	}
+	windowStart, _ := s.config.Prices.NextOffPeak(earliest)
+
+	due, dueAt := -1, time.Time{}
+	for i, job := range jobs {
+		at := windowStart
+		if !job.deadline.IsZero() {
+			if latest := job.deadline.Add(-s.config.DeadlineMargin); latest.Before(at) {
+				at = latest
+			}
+		}
+		if at.Before(earliest) {
+			at = earliest
+		}
+		if due < 0 || at.Before(dueAt) || at.Equal(dueAt) && earlierDeadline(job, jobs[due]) {
+			due, dueAt = i, at
+		}
+	}
+	if dueAt.After(now) {
+		return nil, dueAt.Sub(now)
+	}
+
+	job := jobs[due]
+	s.jobs = slices.Delete(jobs, due, due+1)
+	if s.config.RequestsPerMinute > 0 {
+		s.slot = now.Add(time.Minute / time.Duration(s.config.RequestsPerMinute))
+	}
+	job.sentAt = now
+	job.offPeak = s.config.Prices.IsOffPeak(now)
+	s.stats.Pending--
+	s.stats.Running++
+	if job.offPeak {
+		s.stats.OffPeak++
+	} else {
+		s.stats.Fallback++
+	}
+	return job, 0
+}
+
+func (s *OffPeakScheduler) send(job *OffPeakJob) {
+	response, err := s.chats.CreateCompletion(job.ctx, job.args)
+
+	s.mu.Lock()
+	s.stats.Running--
+	s.mu.Unlock()
+	job.finish(response, err)
+}
+
+// stop fails the pending jobs and the jobs submitted until Run is called again.
+func (s *OffPeakScheduler) stop(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = err
+	for _, job := range s.jobs {
+		job.finish(nil, err)
+	}
+	s.stats.Pending -= len(s.jobs)
+	s.jobs = nil
+}
+
+func (s *OffPeakScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// earlierDeadline reports whether a is due before b, jobs without deadline coming last.
+func earlierDeadline(a, b *OffPeakJob) bool {
+	if a.deadline.IsZero() {
+		return false
+	}
+	return b.deadline.IsZero() || a.deadline.Before(b.deadline)
+}
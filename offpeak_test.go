@@ -0,0 +1,88 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func TestOffPeakScheduler(t *testing.T) {
+	start := time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)
+	clock := deepseektest.NewClock(start)
+	scheduler := deepseek.NewOffPeakScheduler(&fakeChats{content: "Hello!"}, deepseek.OffPeakConfig{
+		Clock:             clock,
+		RequestsPerMinute: 1,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(stopped)
+	}()
+
+	args := deepseek.CompletionArgs{Model: deepseek.DeepSeekChat}
+	first := scheduler.Submit(context.Background(), args, time.Time{})
+	second := scheduler.Submit(context.Background(), args, time.Time{})
+	urgent := scheduler.Submit(context.Background(), args, start.Add(time.Hour))
+	canceledCtx, cancelJob := context.WithCancel(context.Background())
+	canceled := scheduler.Submit(canceledCtx, args, time.Time{})
+
+	clock.Advance(50 * time.Minute)
+	select {
+	case <-urgent.Done():
+		t.Fatalf("job sent at %s; want it held until its deadline", urgent.SentAt())
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The job is sent at standard prices when waiting for the window would miss its deadline.
+	clock.Advance(5 * time.Minute)
+	if _, err := urgent.Result(); err != nil {
+		t.Fatalf("Result() error = %v", err)
+	}
+	if urgent.OffPeak() || !urgent.SentAt().Equal(start.Add(55*time.Minute)) {
+		t.Errorf("urgent job sent at %s (off-peak: %t); want 10:55 at standard prices", urgent.SentAt(), urgent.OffPeak())
+	}
+
+	cancelJob()
+	if _, err := canceled.Result(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Result() error = %v; want context.Canceled", err)
+	}
+
+	// The other jobs are sent in the window, one per minute.
+	clock.Set(time.Date(2025, 2, 1, 16, 30, 0, 0, time.UTC))
+	completion, err := first.Result()
+	if err != nil || completion.Choices[0].Message.Content != "Hello!" {
+		t.Fatalf("Result() = %v, %v", completion, err)
+	}
+	if !first.OffPeak() {
+		t.Errorf("first job sent at %s; want off-peak", first.SentAt())
+	}
+	clock.Advance(time.Minute)
+	<-second.Done()
+	if got := second.SentAt().Sub(first.SentAt()); got != time.Minute {
+		t.Errorf("second job sent %s after the first; want 1m", got)
+	}
+
+	stats := scheduler.Stats()
+	if stats.OffPeak != 2 || stats.Fallback != 1 || stats.Canceled != 1 || stats.Pending != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+
+	// Pending jobs fail when the scheduler stops.
+	late := scheduler.Submit(context.Background(), args, time.Time{})
+	cancel()
+	<-stopped
+	if _, err := late.Result(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Result() error = %v; want the scheduler to be stopped", err)
+	}
+	select {
+	case <-scheduler.Submit(context.Background(), args, time.Time{}).Done():
+	default:
+		t.Error("Submit() after Run returned queued the job; want it failed")
+	}
+}
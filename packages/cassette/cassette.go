@@ -0,0 +1,238 @@
+// Package cassette records HTTP interactions with the DeepSeek API to files and replays them offline.
+//
+// A Recorder is an http.RoundTripper to wire into a client with deepseek.WithHTTPClient:
+//
+//	recorder, err := cassette.New("testdata/completion.json", cassette.ModeReplay)
+//	client, err := deepseek.NewClient(apiKey, deepseek.WithHTTPClient(recorder.Client()))
+//
+// Response bodies are stored verbatim, including the events of streamed completions, so replayed responses are
+// byte-for-byte identical to the recorded ones.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrInteractionNotFound = errors.New("cassette: no recorded interaction matches the request")
+
+type Mode int
+
+const (
+	// ModeReplay serves recorded interactions without reaching the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the network and records the interactions.
+	ModeRecord
+)
+
+// redacted replaces the values of redacted headers.
+const redacted = "REDACTED"
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder records or replays HTTP interactions. It is safe for concurrent use.
+type Recorder struct {
+	mode Mode
+	path string
+
+	// Transport sends the requests in record mode. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// RedactHeaders are the request headers whose values are not recorded. Defaults to Authorization.
+	RedactHeaders []string
+
+	mu       sync.Mutex
+	cassette Cassette
+	replayed []bool
+}
+
+// New creates a recorder for the cassette file at path. In replay mode, the file must exist.
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		mode:          mode,
+		path:          path,
+		Transport:     http.DefaultTransport,
+		RedactHeaders: []string{"Authorization"},
+	}
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("cassette: invalid cassette %s: %w", path, err)
+	}
+	r.replayed = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Client returns an HTTP client using the recorder as transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Interactions returns the interactions of the cassette.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.cassette.Interactions...)
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	upstream := req.Clone(req.Context())
+	upstream.Body = io.NopCloser(bytes.NewReader(body))
+	upstream.ContentLength = int64(len(body))
+
+	resp, err := r.Transport.RoundTrip(upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The whole body is read before returning so streamed responses are recorded in full.
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := req.Header.Clone()
+	for _, name := range r.RedactHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, redacted)
+		}
+	}
+	interaction := Interaction{
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  req.URL.RawQuery,
+			Header: header,
+			Body:   string(body),
+		},
+		Response: Response{
+			Status: resp.StatusCode,
+			Header: resp.Header.Clone(),
+			Body:   string(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.replayed = append(r.replayed, true)
+	err = r.save()
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return newResponse(req, interaction.Response), nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	key := normalizeBody(body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		recorded := interaction.Request
+		if r.replayed[i] || recorded.Method != req.Method || recorded.Path != req.URL.Path || recorded.Query != req.URL.RawQuery {
+			continue
+		}
+		if normalizeBody([]byte(recorded.Body)) != key {
+			continue
+		}
+		r.replayed[i] = true
+		return newResponse(req, interaction.Response), nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, req.URL.Path)
+}
+
+// save writes the cassette to its file. The caller must hold the lock.
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0o644)
+}
+
+func newResponse(req *http.Request, recorded Response) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
+
+// normalizeBody returns a canonical form of JSON bodies, with sorted keys and no insignificant whitespace, so that
+// equivalent requests match. Other bodies are returned as is.
+func normalizeBody(body []byte) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(normalized)
+}
@@ -0,0 +1,118 @@
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/cassette"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "chat.json")
+	args := deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	}
+	streamArgs := deepseek.StreamCompletionArgs{Model: args.Model, Messages: args.Messages}
+
+	run := func(client *deepseek.Client) (string, []string) {
+		t.Helper()
+		completion, err := client.Chats.CreateCompletion(context.Background(), args)
+		if err != nil {
+			t.Fatalf("CreateCompletion() error = %v", err)
+		}
+
+		stream := client.Chats.CreateStreamCompletion(context.Background(), streamArgs)
+		defer stream.Close()
+		var chunks []string
+		for stream.Next() {
+			chunks = append(chunks, stream.Current().Choices[0].Delta.Content)
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		return completion.Choices[0].Message.Content, chunks
+	}
+
+	server := deepseektest.NewServer(t)
+	server.Enqueue(
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello World"),
+		deepseektest.Stream(deepseektest.StreamScript{Chunks: deepseektest.TextChunks(deepseek.DeepSeekChat, "Hello streaming World")}),
+	)
+	recorder, err := cassette.New(path, cassette.ModeRecord)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	client, err := deepseek.NewClient("secret-key", deepseek.WithBaseURL(server.URL), deepseek.WithHTTPClient(recorder.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	recordedContent, recordedChunks := run(client)
+	server.Close()
+
+	for _, interaction := range recorder.Interactions() {
+		if got := interaction.Request.Header.Get("Authorization"); got != "REDACTED" {
+			t.Errorf("recorded Authorization = %q; want REDACTED", got)
+		}
+	}
+
+	replayer, err := cassette.New(path, cassette.ModeReplay)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	client, err = deepseek.NewClient("", deepseek.WithBaseURL(server.URL), deepseek.WithHTTPClient(replayer.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	replayedContent, replayedChunks := run(client)
+
+	if replayedContent != recordedContent || strings.Join(replayedChunks, "|") != strings.Join(recordedChunks, "|") {
+		t.Errorf("replayed %q %q; recorded %q %q", replayedContent, replayedChunks, recordedContent, recordedChunks)
+	}
+
+	// Every interaction is replayed once.
+	if _, err := client.Chats.CreateCompletion(context.Background(), args); !errors.Is(err, cassette.ErrInteractionNotFound) {
+		t.Errorf("CreateCompletion() error = %v; want ErrInteractionNotFound", err)
+	}
+}
+
+func TestReplayMatchesNormalizedBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raw.json")
+	server := deepseektest.NewServer(t)
+	server.Enqueue(deepseektest.Raw(http.StatusOK, `{"raw":true}`))
+
+	recorder, err := cassette.New(path, cassette.ModeRecord)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	resp, err := recorder.Client().Post(server.URL+"/chat/completions", "application/json", strings.NewReader(`{"model":"deepseek-chat","stream":false}`))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	resp.Body.Close()
+
+	replayer, err := cassette.New(path, cassette.ModeReplay)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := replayer.Client().Post(server.URL+"/chat/completions", "application/json", strings.NewReader(`{"model":"deepseek-reasoner"}`)); !errors.Is(err, cassette.ErrInteractionNotFound) {
+		t.Errorf("Post() with another body error = %v; want ErrInteractionNotFound", err)
+	}
+
+	resp, err = replayer.Client().Post(server.URL+"/chat/completions", "application/json", strings.NewReader(`{ "stream": false, "model": "deepseek-chat" }`))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `{"raw":true}` {
+		t.Errorf("replayed body = %q", body)
+	}
+}
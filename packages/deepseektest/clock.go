@@ -0,0 +1,97 @@
+package deepseektest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek"
+)
+
+// Clock is a deepseek.Clock whose time only moves with Advance, to test schedulers without waiting.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []clockWaiter
+	changed chan struct{}
+}
+
+type clockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+var _ deepseek.Clock = (*Clock)(nil)
+
+// NewClock creates a clock set at the given time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, changed: make(chan struct{})}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, clockWaiter{at: c.now.Add(d), ch: ch})
+	c.broadcast()
+	return ch
+}
+
+// Advance moves the clock forward and fires the timers due.
+func (c *Clock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to the given time and fires the timers due.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+	waiters := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.at.After(now) {
+			waiters = append(waiters, waiter)
+			continue
+		}
+		waiter.ch <- now
+	}
+	c.waiters = waiters
+	c.broadcast()
+}
+
+// Waiters returns the number of timers not fired yet.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until n timers are waiting for the clock, e.g. until a scheduler is idle before advancing the clock.
+func (c *Clock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		waiting, changed := len(c.waiters), c.changed
+		c.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// broadcast wakes up BlockUntil. The lock must be held.
+func (c *Clock) broadcast() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
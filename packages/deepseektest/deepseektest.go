@@ -0,0 +1,533 @@
+// Package deepseektest provides an in-process fake of the DeepSeek API for tests.
+//
+// A Server serves queued responses to chat completions, both streamed and not, and fixed responses to the models and
+// balance endpoints. Point a client at it with deepseek.WithBaseURL(server.URL).
+package deepseektest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+)
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Stream reports whether the request is a streaming chat completion.
+func (r Request) Stream() bool {
+	args, _ := r.StreamCompletionArgs()
+	return args.Stream
+}
+
+// StreamCompletionArgs decodes the body of a streaming chat completion request.
+func (r Request) StreamCompletionArgs() (deepseek.StreamCompletionArgs, error) {
+	var args deepseek.StreamCompletionArgs
+	err := json.Unmarshal(r.Body, &args)
+	return args, err
+}
+
+// includeUsage reports whether the request asks for the usage at the end of the stream.
+func (r Request) includeUsage() bool {
+	args, _ := r.StreamCompletionArgs()
+	return args.StreamOptions != nil && args.StreamOptions.IncludeUsage
+}
+
+// CompletionArgs decodes the body of a chat completion request.
+func (r Request) CompletionArgs() (deepseek.CompletionArgs, error) {
+	var args deepseek.CompletionArgs
+	err := json.Unmarshal(r.Body, &args)
+	return args, err
+}
+
+// Server is a fake DeepSeek API server. It is safe for concurrent use.
+type Server struct {
+	// URL is the base URL of the server.
+	URL string
+
+	t      testing.TB
+	server *httptest.Server
+
+	mu        sync.Mutex
+	responses []Response
+	requests  []Request
+	models    deepseek.ModelsList
+	balance   deepseek.UserBalanceResponse
+	apiKey    string
+}
+
+// NewServer starts a fake server which is closed when the test ends. Unexpected requests fail the test.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		t: t,
+		models: deepseek.ModelsList{Data: []deepseek.Model{
+			{ID: string(deepseek.DeepSeekChat), Object: "model", OwnedBy: "deepseek"},
+			{ID: string(deepseek.DeepSeekReasoner), Object: "model", OwnedBy: "deepseek"},
+		}},
+		balance: deepseek.UserBalanceResponse{
+			IsAvailable: true,
+			BalanceInfos: []deepseek.UserBalanceInfo{
+				{Currency: "USD", TotalBalance: "10.00", GrantedBalance: "0.00", ToppedUpBalance: "10.00"},
+			},
+		},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Enqueue queues responses to the next chat completion requests, in order.
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+// Pending returns the number of queued responses not served yet.
+func (s *Server) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.responses)
+}
+
+// SetModels sets the models listed by the server.
+func (s *Server) SetModels(models ...deepseek.Model) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = deepseek.ModelsList{Data: models}
+}
+
+// SetBalance sets the balance returned by the server.
+func (s *Server) SetBalance(balance deepseek.UserBalanceResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balance = balance
+}
+
+// RequireAPIKey makes the server reject requests not authenticated with the API key with a 401 status.
+func (s *Server) RequireAPIKey(apiKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiKey = apiKey
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// LastRequest returns the last request received.
+func (s *Server) LastRequest() (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return Request{}, false
+	}
+	return s.requests[len(s.requests)-1], true
+}
+
+// AssertRequestCount fails the test unless the server received n requests.
+func (s *Server) AssertRequestCount(n int) {
+	s.t.Helper()
+	if got := len(s.Requests()); got != n {
+		s.t.Errorf("deepseektest: received %d requests; want %d", got, n)
+	}
+}
+
+// AssertDrained fails the test if queued responses were not served.
+func (s *Server) AssertDrained() {
+	s.t.Helper()
+	if pending := s.Pending(); pending > 0 {
+		s.t.Errorf("deepseektest: %d queued responses were not served", pending)
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	apiKey := s.apiKey
+	s.mu.Unlock()
+
+	if apiKey != "" && r.Header.Get("Authorization") != "Bearer "+apiKey {
+		writeError(w, http.StatusUnauthorized, "Authentication Fails (no such user)")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/chat/completions":
+		s.handleCompletion(w, r, req)
+	case r.Method == http.MethodGet && r.URL.Path == "/models":
+		s.mu.Lock()
+		models := s.models
+		s.mu.Unlock()
+		writeJSON(w, models)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/models/"):
+		id := strings.TrimPrefix(r.URL.Path, "/models/")
+		s.mu.Lock()
+		models := s.models
+		s.mu.Unlock()
+		for _, model := range models.Data {
+			if model.ID == id {
+				writeJSON(w, model)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model %s not found", id))
+	case r.Method == http.MethodGet && r.URL.Path == "/user/balance":
+		s.mu.Lock()
+		balance := s.balance
+		s.mu.Unlock()
+		writeJSON(w, balance)
+	default:
+		s.t.Errorf("deepseektest: unexpected request %s %s", r.Method, r.URL.Path)
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) handleCompletion(w http.ResponseWriter, r *http.Request, req Request) {
+	s.mu.Lock()
+	if len(s.responses) == 0 {
+		s.mu.Unlock()
+		s.t.Errorf("deepseektest: no queued response for %s %s", r.Method, r.URL.Path)
+		writeError(w, http.StatusInternalServerError, "no queued response")
+		return
+	}
+	response := s.responses[0]
+	s.responses = s.responses[1:]
+	s.mu.Unlock()
+
+	for _, check := range response.checks {
+		if err := check(req); err != nil {
+			s.t.Errorf("deepseektest: unexpected request: %v", err)
+		}
+	}
+	response.serve(w, r, req)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": http.StatusText(status)},
+	})
+}
+
+// Response is a scripted response to a chat completion request.
+type Response struct {
+	status     int
+	body       string
+	raw        bool
+	completion *deepseek.CompletionResponse
+	stream     *StreamScript
+	delay      time.Duration
+	checks     []func(Request) error
+}
+
+// StreamScript describes a streamed completion.
+type StreamScript struct {
+	// Chunks are the chunks sent as events.
+	Chunks []deepseek.StreamCompletionChunk
+
+	// FirstChunkDelay is the delay before the first chunk is sent.
+	FirstChunkDelay time.Duration
+
+	// Delay is the delay between chunks.
+	Delay time.Duration
+
+	// ErrorAfter sends an error event after this many chunks when Error is set.
+	ErrorAfter int
+
+	// Error is the message of an error event sent in the middle of the stream.
+	Error string
+
+	// OmitDone doesn't terminate the stream with the [DONE] event.
+	OmitDone bool
+}
+
+// Completion responds with a completion. Streaming requests receive it as a stream of chunks.
+func Completion(completion deepseek.CompletionResponse) Response {
+	return Response{status: http.StatusOK, completion: &completion}
+}
+
+// Text responds with a completion of the model whose content is text.
+func Text(model deepseek.ModelID, text string) Response {
+	return Completion(deepseek.CompletionResponse{
+		ID:      "chatcmpl-test",
+		Model:   model,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Choices: []deepseek.CompletionChoice{{
+			Message:      deepseek.Message{Role: deepseek.AssistantRole, Content: text},
+			FinishReason: deepseek.CompletionFinishReasonStop,
+		}},
+		Usage: deepseek.CompletionUsage{
+			PromptTokens:          10,
+			PromptCacheMissTokens: 10,
+			CompletionTokens:      int64(len(strings.Fields(text))),
+			TotalTokens:           10 + int64(len(strings.Fields(text))),
+		},
+	})
+}
+
+// ToolCalls responds with a completion of the model calling the given tools.
+func ToolCalls(model deepseek.ModelID, calls ...deepseek.CompletionToolCall) Response {
+	for i := range calls {
+		if calls[i].ID == "" {
+			calls[i].ID = fmt.Sprintf("call_%d", i)
+		}
+		if calls[i].Type == "" {
+			calls[i].Type = deepseek.ToolFunctionType
+		}
+	}
+	return Completion(deepseek.CompletionResponse{
+		ID:      "chatcmpl-test",
+		Model:   model,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Choices: []deepseek.CompletionChoice{{
+			Message:      deepseek.Message{Role: deepseek.AssistantRole, ToolCalls: calls},
+			FinishReason: deepseek.CompletionFinishReasonToolCalls,
+		}},
+		Usage: deepseek.CompletionUsage{PromptTokens: 10, PromptCacheMissTokens: 10, CompletionTokens: 10, TotalTokens: 20},
+	})
+}
+
+// Stream responds with a scripted stream. Non-streaming requests receive the accumulated completion.
+func Stream(script StreamScript) Response {
+	return Response{status: http.StatusOK, stream: &script}
+}
+
+// Error responds with an error status, e.g. http.StatusServiceUnavailable.
+func Error(status int, message string) Response {
+	return Response{status: status, body: message}
+}
+
+// Raw responds with a raw body, e.g. to test malformed responses.
+func Raw(status int, body string) Response {
+	return Response{status: status, body: body, raw: true}
+}
+
+// WithDelay delays the response.
+func (r Response) WithDelay(delay time.Duration) Response {
+	r.delay = delay
+	return r
+}
+
+// Expect checks the request answered by the response. A non-nil error fails the test.
+func (r Response) Expect(check func(Request) error) Response {
+	r.checks = append(r.checks[:len(r.checks):len(r.checks)], check)
+	return r
+}
+
+// ExpectModel checks that the request is for the model.
+func (r Response) ExpectModel(model deepseek.ModelID) Response {
+	return r.Expect(func(req Request) error {
+		args, err := req.CompletionArgs()
+		if err != nil {
+			return err
+		}
+		if args.Model != model {
+			return fmt.Errorf("model is %q; want %q", args.Model, model)
+		}
+		return nil
+	})
+}
+
+func (r Response) serve(w http.ResponseWriter, httpReq *http.Request, req Request) {
+	if !sleep(httpReq, r.delay) {
+		return
+	}
+
+	stream := req.Stream()
+
+	switch {
+	case r.raw:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(r.status)
+		_, _ = io.WriteString(w, r.body)
+	case r.status != http.StatusOK:
+		writeError(w, r.status, r.body)
+	case r.completion != nil && stream:
+		serveStream(w, httpReq, StreamScript{Chunks: Chunks(*r.completion)}, req.includeUsage())
+	case r.completion != nil:
+		writeJSON(w, r.completion)
+	case r.stream != nil && stream:
+		serveStream(w, httpReq, *r.stream, req.includeUsage())
+	case r.stream != nil:
+		var acc deepseek.StreamAccumulator
+		for _, chunk := range r.stream.Chunks {
+			acc.Add(chunk)
+		}
+		writeJSON(w, acc.Response())
+	}
+}
+
+// serveStream writes the events of the script. Like the API, the final usage chunk is only sent when includeUsage is set.
+func serveStream(w http.ResponseWriter, req *http.Request, script StreamScript, includeUsage bool) {
+	if !includeUsage {
+		chunks := make([]deepseek.StreamCompletionChunk, 0, len(script.Chunks))
+		for _, chunk := range script.Chunks {
+			if chunk.Usage != nil && len(chunk.Choices) == 0 {
+				continue
+			}
+			chunk.Usage = nil
+			chunks = append(chunks, chunk)
+		}
+		script.Chunks = chunks
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	if !sleep(req, script.FirstChunkDelay) {
+		return
+	}
+	for i, chunk := range script.Chunks {
+		if i > 0 && !sleep(req, script.Delay) {
+			return
+		}
+		if script.Error != "" && i == script.ErrorAfter {
+			writeEvent(w, map[string]any{"error": map[string]any{"message": script.Error}})
+			flush()
+			return
+		}
+		writeEvent(w, chunk)
+		flush()
+	}
+	if script.Error != "" && script.ErrorAfter >= len(script.Chunks) {
+		writeEvent(w, map[string]any{"error": map[string]any{"message": script.Error}})
+		flush()
+		return
+	}
+	if !script.OmitDone {
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+		flush()
+	}
+}
+
+func writeEvent(w io.Writer, v any) {
+	var buf bytes.Buffer
+	_ = json.NewEncoder(&buf).Encode(v)
+	fmt.Fprintf(w, "data: %s\n\n", bytes.TrimSpace(buf.Bytes()))
+}
+
+// sleep waits for the delay unless the request is cancelled, in which case it returns false.
+func sleep(req *http.Request, delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+// Chunks splits a completion into the chunks of a stream: one chunk per choice carrying its message, followed by a chunk with the usage.
+func Chunks(completion deepseek.CompletionResponse) []deepseek.StreamCompletionChunk {
+	chunk := func() deepseek.StreamCompletionChunk {
+		return deepseek.StreamCompletionChunk{
+			ID:                completion.ID,
+			Model:             completion.Model,
+			Created:           completion.Created,
+			SystemFingerprint: completion.SystemFingerprint,
+			Object:            "chat.completion.chunk",
+		}
+	}
+
+	var chunks []deepseek.StreamCompletionChunk
+	for _, choice := range completion.Choices {
+		c := chunk()
+		delta := deepseek.StreamDelta{Role: choice.Message.Role, Content: choice.Message.Content}
+		for i, call := range choice.Message.ToolCalls {
+			delta.ToolCalls = append(delta.ToolCalls, deepseek.StreamToolCall{
+				Index:    int64(i),
+				ID:       call.ID,
+				Type:     call.Type,
+				Function: call.Function,
+			})
+		}
+		c.Choices = []deepseek.StreamCompletionChoice{{Index: choice.Index, Delta: delta, FinishReason: choice.FinishReason}}
+		chunks = append(chunks, c)
+	}
+
+	usage := completion.Usage
+	c := chunk()
+	c.Choices = []deepseek.StreamCompletionChoice{}
+	c.Usage = &usage
+	return append(chunks, c)
+}
+
+// TextChunks returns the chunks streaming text word by word, followed by a chunk with the usage.
+func TextChunks(model deepseek.ModelID, text string) []deepseek.StreamCompletionChunk {
+	chunk := func(delta deepseek.StreamDelta, finish deepseek.CompletionFinishReason) deepseek.StreamCompletionChunk {
+		return deepseek.StreamCompletionChunk{
+			ID:      "chatcmpl-test",
+			Model:   model,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Choices: []deepseek.StreamCompletionChoice{{Delta: delta, FinishReason: finish}},
+		}
+	}
+
+	words := strings.SplitAfter(text, " ")
+	chunks := []deepseek.StreamCompletionChunk{chunk(deepseek.StreamDelta{Role: deepseek.AssistantRole}, "")}
+	for _, word := range words {
+		chunks = append(chunks, chunk(deepseek.StreamDelta{Content: word}, ""))
+	}
+	chunks = append(chunks, chunk(deepseek.StreamDelta{}, deepseek.CompletionFinishReasonStop))
+
+	last := chunk(deepseek.StreamDelta{}, "")
+	last.Choices = []deepseek.StreamCompletionChoice{}
+	last.Usage = &deepseek.CompletionUsage{
+		PromptTokens:          10,
+		PromptCacheMissTokens: 10,
+		CompletionTokens:      int64(len(words)),
+		TotalTokens:           10 + int64(len(words)),
+	}
+	return append(chunks, last)
+}
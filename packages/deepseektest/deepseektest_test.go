@@ -0,0 +1,167 @@
+package deepseektest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func newClient(t *testing.T, server *deepseektest.Server) *deepseek.Client {
+	t.Helper()
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestCompletion(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	client := newClient(t, server)
+
+	server.Enqueue(
+		deepseektest.Text(deepseek.DeepSeekChat, "Hello World").ExpectModel(deepseek.DeepSeekChat),
+		deepseektest.Error(http.StatusServiceUnavailable, "overloaded"),
+	)
+
+	args := deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	}
+	completion, err := client.Chats.CreateCompletion(context.Background(), args)
+	if err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	if got := completion.Choices[0].Message.Content; got != "Hello World" {
+		t.Errorf("content = %q; want %q", got, "Hello World")
+	}
+
+	if _, err := client.Chats.CreateCompletion(context.Background(), args); !errors.Is(err, deepseek.ErrServiceUnavailable) {
+		t.Errorf("CreateCompletion() error = %v; want ErrServiceUnavailable", err)
+	}
+
+	server.AssertRequestCount(2)
+	server.AssertDrained()
+	req, _ := server.LastRequest()
+	if got := req.Header.Get("Authorization"); got != "Bearer api-key" {
+		t.Errorf("Authorization = %q", got)
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	client := newClient(t, server)
+
+	server.Enqueue(deepseektest.Stream(deepseektest.StreamScript{
+		Chunks: deepseektest.TextChunks(deepseek.DeepSeekChat, "Hello streaming World"),
+		Delay:  time.Millisecond,
+	}))
+
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{
+		Model:         deepseek.DeepSeekChat,
+		StreamOptions: &deepseek.StreamOptions{IncludeUsage: true},
+	})
+	defer stream.Close()
+
+	var acc deepseek.StreamAccumulator
+	for stream.Next() {
+		acc.Add(stream.Current())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	if got := acc.Response().Choices[0].Message.Content; got != "Hello streaming World" {
+		t.Errorf("content = %q", got)
+	}
+	if usage, ok := acc.Usage(); !ok || usage.CompletionTokens != 3 {
+		t.Errorf("Usage() = %+v, %t", usage, ok)
+	}
+}
+
+func TestStreamToolCalls(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	client := newClient(t, server)
+
+	server.Enqueue(deepseektest.ToolCalls(deepseek.DeepSeekChat, deepseek.CompletionToolCall{
+		Function: deepseek.CompletionToolCallFunction{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+	}))
+
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{Model: deepseek.DeepSeekChat})
+	defer stream.Close()
+
+	var acc deepseek.StreamAccumulator
+	for stream.Next() {
+		if len(stream.Current().Choices) == 0 {
+			t.Fatalf("received a usage chunk without IncludeUsage")
+		}
+		acc.Add(stream.Current())
+	}
+
+	choice := acc.Response().Choices[0]
+	if choice.FinishReason != deepseek.CompletionFinishReasonToolCalls || len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("choice = %+v", choice)
+	}
+	if call := choice.Message.ToolCalls[0]; call.ID != "call_0" || call.Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	client := newClient(t, server)
+
+	server.Enqueue(
+		deepseektest.Error(http.StatusTooManyRequests, "slow down"),
+		deepseektest.Stream(deepseektest.StreamScript{
+			Chunks:     deepseektest.TextChunks(deepseek.DeepSeekChat, "Hello World"),
+			ErrorAfter: 2,
+			Error:      "connection reset",
+		}),
+	)
+
+	stream := client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{Model: deepseek.DeepSeekChat})
+	if stream.Next() || !errors.Is(stream.Err(), deepseek.ErrRateLimitExceeded) {
+		t.Errorf("Err() = %v; want ErrRateLimitExceeded", stream.Err())
+	}
+	stream.Close()
+
+	stream = client.Chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{Model: deepseek.DeepSeekChat})
+	defer stream.Close()
+	var chunks int
+	for stream.Next() {
+		chunks++
+	}
+	if chunks != 2 || stream.Err() == nil || !strings.Contains(stream.Err().Error(), "connection reset") {
+		t.Errorf("received %d chunks and error %v; want 2 chunks and the scripted error", chunks, stream.Err())
+	}
+}
+
+func TestModelsAndBalance(t *testing.T) {
+	server := deepseektest.NewServer(t)
+	client := newClient(t, server)
+
+	server.SetModels(deepseek.Model{ID: "custom", Object: "model", OwnedBy: "me"})
+	models, err := client.Models.ListModels()
+	if err != nil || len(models.Data) != 1 || models.Data[0].ID != "custom" {
+		t.Errorf("ListModels() = %+v, %v", models, err)
+	}
+	if _, err := client.Models.GetModel("deepseek-chat"); !errors.Is(err, deepseek.ErrModelNotFound) {
+		t.Errorf("GetModel() error = %v; want ErrModelNotFound", err)
+	}
+
+	balance, err := client.Balance.GetUserBalance()
+	if err != nil || !balance.IsAvailable {
+		t.Errorf("GetUserBalance() = %+v, %v", balance, err)
+	}
+
+	server.RequireAPIKey("other-key")
+	if _, err := client.Balance.GetUserBalance(); !errors.Is(err, deepseek.ErrAuthenticationFailed) {
+		t.Errorf("GetUserBalance() error = %v; want ErrAuthenticationFailed", err)
+	}
+}
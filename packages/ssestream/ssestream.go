@@ -112,16 +112,26 @@ func (s *eventStreamDecoder) Close() error {
 }
 
 func (s *eventStreamDecoder) Err() error {
-	return s.err
+	if s.err != nil {
+		return s.err
+	}
+	return s.scn.Err()
 }
 
 type Stream[T any] struct {
-	decoder Decoder
-	cur     T
-	err     error
-	done    bool
+	decoder  Decoder
+	cur      T
+	err      error
+	done     bool
+	finished bool
+	peeked   bool
+	onDone   []func(error)
+
+	// stages are the transforms and the OnChunk callbacks, in the order they were registered.
+	stages []func(T) T
 }
 
+// NewStream creates a stream decoding events from decoder. The stream fails immediately when err is not nil, in which case decoder may be nil.
 func NewStream[T any](decoder Decoder, err error) *Stream[T] {
 	return &Stream[T]{
 		decoder: decoder,
@@ -129,8 +139,60 @@ func NewStream[T any](decoder Decoder, err error) *Stream[T] {
 	}
 }
 
+// OnChunk registers a callback invoked with every item decoded from the stream, before Next returns. The item is
+// rewritten by the transforms registered before the callback only.
+func (s *Stream[T]) OnChunk(fn func(T)) {
+	s.stages = append(s.stages, func(item T) T {
+		fn(item)
+		return item
+	})
+}
+
+// OnDone registers a callback invoked once when the stream ends, either because it was fully consumed, failed or was closed.
+// The callback receives the error of the stream, if any. It is invoked immediately when the stream already ended.
+func (s *Stream[T]) OnDone(fn func(error)) {
+	if s.finished {
+		fn(s.err)
+		return
+	}
+	s.onDone = append(s.onDone, fn)
+}
+
+// Transform registers a function rewriting every item decoded from the stream before it is reported by Current and
+// passed to the OnChunk callbacks registered afterwards. The callbacks registered before, e.g. by the inner middlewares
+// of a chain, observe the item as decoded.
+func (s *Stream[T]) Transform(fn func(T) T) {
+	s.stages = append(s.stages, fn)
+}
+
 func (s *Stream[T]) Next() bool {
-	if s.err != nil {
+	if s.peeked {
+		s.peeked = false
+		s.deliver()
+		return true
+	}
+	if !s.advance() {
+		return false
+	}
+	s.deliver()
+	return true
+}
+
+// Peek decodes the first item of the stream without consuming it: the next call to Next reports it. It reports whether
+// an item is available, e.g. to check that the stream didn't fail before handing it over.
+//
+// Transforms and OnChunk callbacks are applied to the item when Next reports it, even when registered after Peek.
+func (s *Stream[T]) Peek() bool {
+	if !s.peeked {
+		s.peeked = s.advance()
+	}
+	return s.peeked
+}
+
+// advance decodes the next item into cur.
+func (s *Stream[T]) advance() bool {
+	if s.err != nil || s.decoder == nil {
+		s.finish()
 		return false
 	}
 
@@ -148,15 +210,43 @@ func (s *Stream[T]) Next() bool {
 		ep := gjson.GetBytes(s.decoder.Event().Data, "error")
 		if ep.Exists() {
 			s.err = fmt.Errorf("received error while streaming: %s", ep.String())
+			s.finish()
 			return false
 		}
-		s.err = json.Unmarshal(s.decoder.Event().Data, &s.cur)
-		return s.err == nil
+		var cur T
+		s.err = json.Unmarshal(s.decoder.Event().Data, &cur)
+		if s.err != nil {
+			s.finish()
+			return false
+		}
+		s.cur = cur
+		return true
 	}
 
+	if s.err == nil {
+		s.err = s.decoder.Err()
+	}
+	s.finish()
 	return false
 }
 
+// deliver applies the transforms and callbacks to the current item.
+func (s *Stream[T]) deliver() {
+	for _, fn := range s.stages {
+		s.cur = fn(s.cur)
+	}
+}
+
+func (s *Stream[T]) finish() {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	for _, fn := range s.onDone {
+		fn(s.err)
+	}
+}
+
 func (s *Stream[T]) Current() T {
 	return s.cur
 }
@@ -166,5 +256,9 @@ func (s *Stream[T]) Err() error {
 }
 
 func (s *Stream[T]) Close() error {
+	s.finish()
+	if s.decoder == nil {
+		return nil
+	}
 	return s.decoder.Close()
 }
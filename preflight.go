@@ -0,0 +1,158 @@
+package deepseek
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrContextLengthExceeded = errors.New("context length exceeded")
+
+const (
+	// defaultContextWindow is used for models missing from DefaultModels.
+	defaultContextWindow = 65536
+	// defaultMaxTokens is the number of tokens generated when MaxTokens is not set, for models missing from DefaultModels.
+	defaultMaxTokens = 4096
+	// toolsHeaderTokens approximates the instructions wrapping the tool definitions in the prompt.
+	toolsHeaderTokens = 16
+	// toolOverheadTokens approximates the tokens wrapping each tool definition.
+	toolOverheadTokens = 8
+	// jsonModeTokens approximates the hint added to the prompt in JSON mode.
+	jsonModeTokens = 8
+)
+
+// Preflight is an estimation of the token budget of a completion request before it is sent.
+type Preflight struct {
+	// PromptTokens is the estimated number of prompt tokens.
+	PromptTokens int64
+
+	// MaxTokens is the number of tokens the request allows the model to generate.
+	MaxTokens int64
+
+	// ContextWindow is the context length of the model.
+	ContextWindow int64
+
+	// RemainingTokens is the part of the context window left for the completion once the prompt is accounted for.
+	RemainingTokens int64
+
+	// MaxSafeTokens is the largest MaxTokens value that fits in the remaining context and the model output limit.
+	MaxSafeTokens int64
+}
+
+// Fits reports whether the prompt and the requested completion fit in the context window.
+func (p Preflight) Fits() bool {
+	return p.RemainingTokens > 0 && p.MaxTokens <= p.RemainingTokens
+}
+
+// Err returns ErrContextLengthExceeded when the request doesn't fit in the context window.
+func (p Preflight) Err() error {
+	if p.Fits() {
+		return nil
+	}
+	return fmt.Errorf("%w: %d prompt tokens and %d max tokens for a context window of %d tokens", ErrContextLengthExceeded, p.PromptTokens, p.MaxTokens, p.ContextWindow)
+}
+
+// Preflight estimates the prompt tokens of the request and the completion budget left in the model's context window.
+//
+// The limits of the model are looked up in DefaultModels.
+func (args CompletionArgs) Preflight() Preflight {
+	prompt := args.EstimatePromptTokens()
+
+	window, limit, maxTokens := int64(defaultContextWindow), int64(defaultContextWindow), int64(defaultMaxTokens)
+	if model, ok := LookupModel(args.Model); ok {
+		// Registered models may leave some limits unset, each one falls back on its own.
+		if model.ContextWindow > 0 {
+			window = model.ContextWindow
+		}
+		limit = window
+		if model.MaxOutputTokens > 0 {
+			limit = model.MaxOutputTokens
+		}
+		if model.DefaultMaxTokens > 0 {
+			maxTokens = model.DefaultMaxTokens
+		}
+	}
+	if args.MaxTokens > 0 {
+		maxTokens = int64(args.MaxTokens)
+	}
+
+	remaining := window - prompt
+	return Preflight{
+		PromptTokens:    prompt,
+		MaxTokens:       maxTokens,
+		ContextWindow:   window,
+		RemainingTokens: remaining,
+		MaxSafeTokens:   max(0, min(remaining, limit)),
+	}
+}
+
+// EstimatePromptTokens estimates the prompt tokens of the request: messages and chat template, tool definitions and the response format hint.
+func (args CompletionArgs) EstimatePromptTokens() int64 {
+	tokens := CountMessageTokens(args)
+
+	if len(args.Tools) > 0 {
+		tokens += toolsHeaderTokens
+		for _, tool := range args.Tools {
+			definition, err := json.Marshal(tool.Function)
+			if err != nil {
+				continue
+			}
+			tokens += toolOverheadTokens + CountTokens(args.Model, string(definition))
+		}
+	}
+
+	if args.ResponseFormat != nil && args.ResponseFormat.Type == ResponseFormatJson {
+		tokens += jsonModeTokens
+	}
+	return tokens
+}
+
+// Preflight estimates the prompt tokens of the request and the completion budget left in the model's context window.
+func (args StreamCompletionArgs) Preflight() Preflight {
+	return args.completionArgs().Preflight()
+}
+
+// EstimatePromptTokens estimates the prompt tokens of the request: messages and chat template, tool definitions and the response format hint.
+func (args StreamCompletionArgs) EstimatePromptTokens() int64 {
+	return args.completionArgs().EstimatePromptTokens()
+}
+
+// streamArgs returns the streaming completion with the same parameters.
+func (args CompletionArgs) streamArgs(options *StreamOptions) StreamCompletionArgs {
+	return StreamCompletionArgs{
+		Model:            args.Model,
+		Messages:         args.Messages,
+		FrequencyPenalty: args.FrequencyPenalty,
+		MaxTokens:        args.MaxTokens,
+		PresencePenalty:  args.PresencePenalty,
+		ResponseFormat:   args.ResponseFormat,
+		Stop:             args.Stop,
+		Stream:           true,
+		StreamOptions:    options,
+		Temperature:      args.Temperature,
+		TopP:             args.TopP,
+		Tools:            args.Tools,
+		ToolChoice:       args.ToolChoice,
+		Logprobs:         args.Logprobs,
+		TopLogprobs:      args.TopLogprobs,
+	}
+}
+
+// completionArgs returns the request parameters shared with a non-streaming completion.
+func (args StreamCompletionArgs) completionArgs() CompletionArgs {
+	return CompletionArgs{
+		Model:            args.Model,
+		Messages:         args.Messages,
+		FrequencyPenalty: args.FrequencyPenalty,
+		MaxTokens:        args.MaxTokens,
+		PresencePenalty:  args.PresencePenalty,
+		ResponseFormat:   args.ResponseFormat,
+		Stop:             args.Stop,
+		Temperature:      args.Temperature,
+		TopP:             args.TopP,
+		Tools:            args.Tools,
+		ToolChoice:       args.ToolChoice,
+		Logprobs:         args.Logprobs,
+		TopLogprobs:      args.TopLogprobs,
+	}
+}
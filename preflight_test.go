@@ -0,0 +1,96 @@
+package deepseek
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	withTestTokenizer(t)
+
+	args := CompletionArgs{
+		Model: DeepSeekChat,
+		Messages: []Message{
+			{Role: UserRole, Content: "Hello World"},
+		},
+	}
+
+	preflight := args.Preflight()
+	if want := int64(beginOfSentenceTokens + userTurnTokens + 2 + generationPromptTokens); preflight.PromptTokens != want {
+		t.Errorf("PromptTokens = %d; want %d", preflight.PromptTokens, want)
+	}
+	if preflight.MaxTokens != defaultMaxTokens {
+		t.Errorf("MaxTokens = %d; want %d", preflight.MaxTokens, defaultMaxTokens)
+	}
+	if preflight.RemainingTokens != preflight.ContextWindow-preflight.PromptTokens {
+		t.Errorf("RemainingTokens = %d; want %d", preflight.RemainingTokens, preflight.ContextWindow-preflight.PromptTokens)
+	}
+	model, _ := LookupModel(DeepSeekChat)
+	if preflight.MaxSafeTokens != model.MaxOutputTokens {
+		t.Errorf("MaxSafeTokens = %d; want %d", preflight.MaxSafeTokens, model.MaxOutputTokens)
+	}
+	if err := preflight.Err(); err != nil {
+		t.Errorf("Err() = %v; want nil", err)
+	}
+
+	withTools := args
+	withTools.Tools = []Tool{{
+		Type: ToolFunctionType,
+		Function: ToolFunction{
+			Name:        "get_weather",
+			Description: "Get the weather of a city",
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			},
+		},
+	}}
+	withTools.ResponseFormat = &ResponseFormat{Type: ResponseFormatJson}
+	if got := withTools.EstimatePromptTokens(); got <= preflight.PromptTokens+toolsHeaderTokens+toolOverheadTokens+jsonModeTokens {
+		t.Errorf("EstimatePromptTokens() with tools = %d; want more than %d", got, preflight.PromptTokens+toolsHeaderTokens+toolOverheadTokens+jsonModeTokens)
+	}
+}
+
+func TestPreflightExceeded(t *testing.T) {
+	args := CompletionArgs{
+		Model: DeepSeekChat,
+		Messages: []Message{
+			{Role: UserRole, Content: strings.Repeat("你好", 60000)},
+		},
+	}
+
+	preflight := args.Preflight()
+	if preflight.Fits() {
+		t.Errorf("Fits() = true; want false for %d prompt tokens", preflight.PromptTokens)
+	}
+	if preflight.MaxSafeTokens != 0 {
+		t.Errorf("MaxSafeTokens = %d; want 0", preflight.MaxSafeTokens)
+	}
+	if err := preflight.Err(); !errors.Is(err, ErrContextLengthExceeded) {
+		t.Errorf("Err() = %v; want ErrContextLengthExceeded", err)
+	}
+}
+
+func TestPreflightPartialModel(t *testing.T) {
+	RegisterModel(ModelInfo{ID: "partial", ContextWindow: 8192})
+	t.Cleanup(func() { DefaultModels.Unregister("partial") })
+
+	args := CompletionArgs{
+		Model:    "partial",
+		Messages: []Message{{Role: UserRole, Content: "Hello World"}},
+	}
+	preflight := args.Preflight()
+	if preflight.ContextWindow != 8192 {
+		t.Errorf("ContextWindow = %d; want 8192", preflight.ContextWindow)
+	}
+	if preflight.MaxTokens != defaultMaxTokens {
+		t.Errorf("MaxTokens = %d; want %d", preflight.MaxTokens, defaultMaxTokens)
+	}
+	if preflight.MaxSafeTokens != preflight.RemainingTokens {
+		t.Errorf("MaxSafeTokens = %d; want the remaining %d tokens", preflight.MaxSafeTokens, preflight.RemainingTokens)
+	}
+	if err := preflight.Err(); err != nil {
+		t.Errorf("Err() = %v; want nil", err)
+	}
+}
@@ -0,0 +1,194 @@
+package deepseek
+
+import (
+	"sync"
+	"time"
+)
+
+type Currency string
+
+const (
+	USD Currency = "USD"
+	CNY Currency = "CNY"
+)
+
+// Price is the price of one million tokens.
+type Price struct {
+	// InputCacheHit is the price of prompt tokens served from the context cache.
+	InputCacheHit float64
+
+	// InputCacheMiss is the price of prompt tokens not found in the context cache.
+	InputCacheMiss float64
+
+	// Output is the price of completion tokens, reasoning tokens included.
+	Output float64
+}
+
+// ModelPrice holds the prices of a model in every currency.
+type ModelPrice struct {
+	// Standard are the prices applied outside of the off-peak window.
+	Standard map[Currency]Price
+
+	// OffPeak are the discounted prices applied during the off-peak window. Standard prices apply when nil.
+	OffPeak map[Currency]Price
+}
+
+// Amount is an amount of money in every supported currency.
+type Amount struct {
+	USD float64
+	CNY float64
+}
+
+// Add returns the sum of both amounts.
+func (a Amount) Add(other Amount) Amount {
+	return Amount{USD: a.USD + other.USD, CNY: a.CNY + other.CNY}
+}
+
+// In returns the amount in the given currency.
+func (a Amount) In(currency Currency) float64 {
+	switch currency {
+	case USD:
+		return a.USD
+	case CNY:
+		return a.CNY
+	default:
+		return 0
+	}
+}
+
+// PriceTable computes the cost of completions from per-model prices. It is safe for concurrent use.
+type PriceTable struct {
+	mu     sync.RWMutex
+	models map[ModelID]ModelPrice
+
+	// The off-peak window is expressed as offsets from midnight UTC and may wrap around midnight.
+	offPeakStart time.Duration
+	offPeakEnd   time.Duration
+}
+
+// DefaultPrices is the price table used by Cost. Its prices can be overridden with SetModelPrice.
+var DefaultPrices = NewPriceTable()
+
+// NewPriceTable creates a price table with the prices published at https://api-docs.deepseek.com/quick_start/pricing
+//
+// The off-peak window runs from 16:30 to 00:30 UTC.
+func NewPriceTable() *PriceTable {
+	chat := ModelPrice{
+		Standard: map[Currency]Price{
+			USD: {InputCacheHit: 0.07, InputCacheMiss: 0.27, Output: 1.10},
+			CNY: {InputCacheHit: 0.5, InputCacheMiss: 2, Output: 8},
+		},
+		OffPeak: map[Currency]Price{
+			USD: {InputCacheHit: 0.035, InputCacheMiss: 0.135, Output: 0.550},
+			CNY: {InputCacheHit: 0.25, InputCacheMiss: 1, Output: 4},
+		},
+	}
+	reasoner := ModelPrice{
+		Standard: map[Currency]Price{
+			USD: {InputCacheHit: 0.14, InputCacheMiss: 0.55, Output: 2.19},
+			CNY: {InputCacheHit: 1, InputCacheMiss: 4, Output: 16},
+		},
+		OffPeak: map[Currency]Price{
+			USD: {InputCacheHit: 0.035, InputCacheMiss: 0.135, Output: 0.550},
+			CNY: {InputCacheHit: 0.25, InputCacheMiss: 1, Output: 4},
+		},
+	}
+
+	return &PriceTable{
+		models: map[ModelID]ModelPrice{
+			DeepSeekChat:     chat,
+			DeepSeekCoder:    chat,
+			DeepSeekReasoner: reasoner,
+		},
+		offPeakStart: 16*time.Hour + 30*time.Minute,
+		offPeakEnd:   30 * time.Minute,
+	}
+}
+
+// SetModelPrice sets or overrides the prices of a model.
+func (t *PriceTable) SetModelPrice(model ModelID, price ModelPrice) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.models[model] = price
+}
+
+// ModelPrice returns the prices of a model.
+func (t *PriceTable) ModelPrice(model ModelID) (ModelPrice, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	price, ok := t.models[model]
+	return price, ok
+}
+
+// SetOffPeakWindow sets the discount window as offsets from midnight UTC. The window wraps around midnight when end is before start.
+func (t *PriceTable) SetOffPeakWindow(start, end time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.offPeakStart = start
+	t.offPeakEnd = end
+}
+
+// IsOffPeak reports whether off-peak prices apply at the given time.
+func (t *PriceTable) IsOffPeak(at time.Time) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	at = at.UTC()
+	offset := at.Sub(time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC))
+	if t.offPeakStart <= t.offPeakEnd {
+		return offset >= t.offPeakStart && offset < t.offPeakEnd
+	}
+	return offset >= t.offPeakStart || offset < t.offPeakEnd
+}
+
+// NextOffPeak returns the off-peak window in progress at the given time, or the next one.
+func (t *PriceTable) NextOffPeak(at time.Time) (start, end time.Time) {
+	t.mu.RLock()
+	startOffset, endOffset := t.offPeakStart, t.offPeakEnd
+	t.mu.RUnlock()
+	if endOffset < startOffset {
+		endOffset += 24 * time.Hour
+	}
+
+	at = at.UTC()
+	midnight := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	// The window of the previous day may still be in progress when it wraps around midnight.
+	for day := -1; ; day++ {
+		start = midnight.AddDate(0, 0, day).Add(startOffset)
+		end = midnight.AddDate(0, 0, day).Add(endOffset)
+		if at.Before(end) {
+			return start, end
+		}
+	}
+}
+
+// Cost computes the cost of the usage of a completion made with the model at the given time.
+//
+// Unknown models cost nothing.
+func (t *PriceTable) Cost(usage CompletionUsage, model ModelID, at time.Time) Amount {
+	price, ok := t.ModelPrice(model)
+	if !ok {
+		return Amount{}
+	}
+
+	prices := price.Standard
+	if price.OffPeak != nil && t.IsOffPeak(at) {
+		prices = price.OffPeak
+	}
+
+	hit, miss := usage.PromptCacheHitTokens, usage.PromptCacheMissTokens
+	if hit+miss == 0 {
+		// Usage without cache details, e.g. estimated usage, is billed as cache misses.
+		miss = usage.PromptTokens
+	}
+
+	cost := func(p Price) float64 {
+		return (float64(hit)*p.InputCacheHit + float64(miss)*p.InputCacheMiss + float64(usage.CompletionTokens)*p.Output) / 1_000_000
+	}
+	return Amount{USD: cost(prices[USD]), CNY: cost(prices[CNY])}
+}
+
+// Cost computes the cost of the usage of a completion made with the model at the given time using DefaultPrices.
+func Cost(usage CompletionUsage, model ModelID, at time.Time) Amount {
+	return DefaultPrices.Cost(usage, model, at)
+}
@@ -0,0 +1,135 @@
+package deepseek
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIsOffPeak(t *testing.T) {
+	prices := NewPriceTable()
+
+	tests := []struct {
+		at       time.Time
+		expected bool
+	}{
+		{at: time.Date(2025, 2, 1, 16, 29, 0, 0, time.UTC), expected: false},
+		{at: time.Date(2025, 2, 1, 16, 30, 0, 0, time.UTC), expected: true},
+		{at: time.Date(2025, 2, 1, 23, 59, 0, 0, time.UTC), expected: true},
+		{at: time.Date(2025, 2, 2, 0, 29, 0, 0, time.UTC), expected: true},
+		{at: time.Date(2025, 2, 2, 0, 30, 0, 0, time.UTC), expected: false},
+		{at: time.Date(2025, 2, 2, 1, 0, 0, 0, time.FixedZone("UTC+8", 8*60*60)), expected: true},
+	}
+
+	for _, tt := range tests {
+		if got := prices.IsOffPeak(tt.at); got != tt.expected {
+			t.Errorf("IsOffPeak(%s) = %t; want %t", tt.at, got, tt.expected)
+		}
+	}
+}
+
+func TestNextOffPeak(t *testing.T) {
+	prices := NewPriceTable()
+
+	tests := []struct {
+		at    time.Time
+		start time.Time
+	}{
+		{at: time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC), start: time.Date(2025, 2, 1, 16, 30, 0, 0, time.UTC)},
+		{at: time.Date(2025, 2, 1, 20, 0, 0, 0, time.UTC), start: time.Date(2025, 2, 1, 16, 30, 0, 0, time.UTC)},
+		{at: time.Date(2025, 2, 2, 0, 15, 0, 0, time.UTC), start: time.Date(2025, 2, 1, 16, 30, 0, 0, time.UTC)},
+		{at: time.Date(2025, 2, 2, 0, 30, 0, 0, time.UTC), start: time.Date(2025, 2, 2, 16, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		start, end := prices.NextOffPeak(tt.at)
+		if !start.Equal(tt.start) || !end.Equal(tt.start.Add(8*time.Hour)) {
+			t.Errorf("NextOffPeak(%s) = %s, %s; want %s, %s", tt.at, start, end, tt.start, tt.start.Add(8*time.Hour))
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	usage := CompletionUsage{
+		PromptTokens:          2_000_000,
+		PromptCacheHitTokens:  1_000_000,
+		PromptCacheMissTokens: 1_000_000,
+		CompletionTokens:      1_000_000,
+	}
+	peak := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	offPeak := time.Date(2025, 2, 1, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		model    ModelID
+		at       time.Time
+		expected Amount
+	}{
+		{name: "Chat", model: DeepSeekChat, at: peak, expected: Amount{USD: 1.44, CNY: 10.5}},
+		{name: "Chat off-peak", model: DeepSeekChat, at: offPeak, expected: Amount{USD: 0.72, CNY: 5.25}},
+		{name: "Reasoner", model: DeepSeekReasoner, at: peak, expected: Amount{USD: 2.88, CNY: 21}},
+		{name: "Unknown model", model: "unknown", at: peak, expected: Amount{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewPriceTable().Cost(usage, tt.model, tt.at)
+			if math.Abs(got.USD-tt.expected.USD) > 1e-9 || math.Abs(got.CNY-tt.expected.CNY) > 1e-9 {
+				t.Errorf("Cost() = %+v; want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetModelPrice(t *testing.T) {
+	prices := NewPriceTable()
+	prices.SetModelPrice("self-hosted", ModelPrice{
+		Standard: map[Currency]Price{USD: {InputCacheMiss: 1, Output: 2}},
+	})
+
+	// Prompt tokens without cache details are billed as cache misses.
+	got := prices.Cost(CompletionUsage{PromptTokens: 1_000_000, CompletionTokens: 1_000_000}, "self-hosted", time.Now())
+	if got.USD != 3 || got.CNY != 0 {
+		t.Errorf("Cost() = %+v; want {USD:3 CNY:0}", got)
+	}
+}
+
+func TestStreamAccumulator(t *testing.T) {
+	var acc StreamAccumulator
+	acc.Add(StreamCompletionChunk{
+		ID:      "1",
+		Model:   DeepSeekReasoner,
+		Created: time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC).Unix(),
+		Choices: []StreamCompletionChoice{{Delta: StreamDelta{Role: AssistantRole, ReasoningContent: "Thinking"}}},
+	})
+	acc.Add(StreamCompletionChunk{
+		ID:      "1",
+		Model:   DeepSeekReasoner,
+		Created: time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC).Unix(),
+		Choices: []StreamCompletionChoice{{Delta: StreamDelta{Content: "Hello"}}},
+	})
+	acc.Add(StreamCompletionChunk{
+		ID:      "1",
+		Model:   DeepSeekReasoner,
+		Created: time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC).Unix(),
+		Choices: []StreamCompletionChoice{{Delta: StreamDelta{Content: " World"}, FinishReason: CompletionFinishReasonStop}},
+		Usage:   &CompletionUsage{PromptCacheMissTokens: 1_000_000, CompletionTokens: 1_000_000},
+	})
+
+	response := acc.Response()
+	if len(response.Choices) != 1 || response.Choices[0].Message.Content != "Hello World" {
+		t.Fatalf("Response() choices = %+v", response.Choices)
+	}
+	if response.Choices[0].FinishReason != CompletionFinishReasonStop {
+		t.Errorf("FinishReason = %q; want %q", response.Choices[0].FinishReason, CompletionFinishReasonStop)
+	}
+	if got := acc.ReasoningContent(0); got != "Thinking" {
+		t.Errorf("ReasoningContent() = %q; want %q", got, "Thinking")
+	}
+	if got := acc.Cost(); math.Abs(got.USD-2.74) > 1e-9 {
+		t.Errorf("Cost() = %+v; want 2.74 USD", got)
+	}
+	if got := response.Cost(); got != acc.Cost() {
+		t.Errorf("Response().Cost() = %+v; want %+v", got, acc.Cost())
+	}
+}
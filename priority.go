@@ -0,0 +1,292 @@
+package deepseek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// ErrQueueTimeout is returned when a request waits in a PriorityScheduler past its queue deadline, see WithQueueDeadline.
+var ErrQueueTimeout = errors.New("queue deadline exceeded")
+
+type priorityKey struct{}
+
+type queueDeadlineKey struct{}
+
+// WithPriority returns a context whose requests are scheduled in the given priority class by a PriorityScheduler.
+func WithPriority(ctx context.Context, class string) context.Context {
+	return context.WithValue(ctx, priorityKey{}, class)
+}
+
+// PriorityFromContext returns the priority class carried by ctx, if any.
+func PriorityFromContext(ctx context.Context) (string, bool) {
+	class, ok := ctx.Value(priorityKey{}).(string)
+	return class, ok
+}
+
+// WithQueueDeadline returns a context whose requests give up waiting in a PriorityScheduler at deadline with
+// ErrQueueTimeout. Unlike the deadline of the context, it doesn't limit the request once sent.
+func WithQueueDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, queueDeadlineKey{}, deadline)
+}
+
+// PriorityClass is a class of requests sharing a queue of a PriorityScheduler.
+type PriorityClass struct {
+	Name string
+
+	// Weight is the share of the capacity the class gets when every class has queued requests. Defaults to 1.
+	Weight int
+
+	// MaxInFlight is the maximum number of requests of the class in flight. Zero means no limit besides the global one.
+	MaxInFlight int
+}
+
+// PrioritySchedulerConfig configures a PriorityScheduler.
+type PrioritySchedulerConfig struct {
+	Classes []PriorityClass
+
+	// DefaultClass is the class of requests without priority or with an unknown one. Defaults to the first class.
+	DefaultClass string
+
+	// MaxInFlight is the maximum number of requests in flight. Zero means no limit besides the limits of the classes.
+	MaxInFlight int
+
+	// Clock measures the waits and queue deadlines. Defaults to SystemClock.
+	Clock Clock
+}
+
+// PriorityClassStats are statistics of a priority class.
+type PriorityClassStats struct {
+	// Queued is the number of requests waiting.
+	Queued int
+
+	// InFlight is the number of requests sent and not completed yet.
+	InFlight int
+
+	// Served is the number of requests that left the queue to be sent.
+	Served int64
+
+	// Abandoned is the number of requests that left the queue because their context was done or their queue deadline passed.
+	Abandoned int64
+
+	// TotalWait is the cumulated wait of the served requests, and MaxWait the longest one.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// AverageWait returns the average wait of the served requests.
+func (s PriorityClassStats) AverageWait() time.Duration {
+	if s.Served == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Served)
+}
+
+// PrioritySchedulerStats are statistics of a PriorityScheduler.
+type PrioritySchedulerStats struct {
+	InFlight int
+	Classes  map[string]PriorityClassStats
+}
+
+// PriorityScheduler queues requests by priority class in front of a ChatService, with weighted fair queuing between the
+// classes and limits on the requests in flight, see Middleware.
+type PriorityScheduler struct {
+	mu           sync.Mutex
+	classes      map[string]*priorityQueue
+	order        []*priorityQueue
+	defaultClass *priorityQueue
+	maxInFlight  int
+	clock        Clock
+	inFlight     int
+	// virtualTime is the pass of the last class served, see priorityQueue.pass.
+	virtualTime float64
+}
+
+// priorityQueue is the queue of a class. Classes are served in increasing pass order, the pass of a class advancing
+// by the inverse of its weight when served, which is stride scheduling.
+type priorityQueue struct {
+	class   PriorityClass
+	waiters []*priorityWaiter
+	pass    float64
+	stats   PriorityClassStats
+}
+
+type priorityWaiter struct {
+	ready    chan struct{}
+	queuedAt time.Time
+}
+
+// NewPriorityScheduler creates a priority scheduler.
+func NewPriorityScheduler(config PrioritySchedulerConfig) (*PriorityScheduler, error) {
+	if len(config.Classes) == 0 {
+		return nil, errors.New("no priority class")
+	}
+
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+
+	s := &PriorityScheduler{classes: make(map[string]*priorityQueue), maxInFlight: config.MaxInFlight, clock: config.Clock}
+	for _, class := range config.Classes {
+		if _, ok := s.classes[class.Name]; ok {
+			return nil, fmt.Errorf("duplicate priority class %q", class.Name)
+		}
+		if class.Weight <= 0 {
+			class.Weight = 1
+		}
+		queue := &priorityQueue{class: class}
+		s.classes[class.Name] = queue
+		s.order = append(s.order, queue)
+	}
+
+	s.defaultClass = s.order[0]
+	if config.DefaultClass != "" {
+		queue, ok := s.classes[config.DefaultClass]
+		if !ok {
+			return nil, fmt.Errorf("unknown default priority class %q", config.DefaultClass)
+		}
+		s.defaultClass = queue
+	}
+	return s, nil
+}
+
+// Acquire waits for the turn of a request in the class of ctx, see WithPriority. The release function must be called
+// once the request completes.
+//
+// It fails with the error of ctx when ctx is done, or with ErrQueueTimeout when the queue deadline of ctx passes.
+func (s *PriorityScheduler) Acquire(ctx context.Context) (release func(), err error) {
+	queue := s.defaultClass
+	if class, ok := PriorityFromContext(ctx); ok {
+		if q, ok := s.classes[class]; ok {
+			queue = q
+		}
+	}
+
+	waiter := &priorityWaiter{ready: make(chan struct{}), queuedAt: s.clock.Now()}
+	s.mu.Lock()
+	if len(queue.waiters) == 0 {
+		// A class becoming active can't claim the turns it missed while idle.
+		queue.pass = max(queue.pass, s.virtualTime)
+	}
+	queue.waiters = append(queue.waiters, waiter)
+	queue.stats.Queued++
+	s.dispatch()
+	s.mu.Unlock()
+
+	release = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.inFlight--
+		queue.stats.InFlight--
+		s.dispatch()
+	}
+	release = sync.OnceFunc(release)
+
+	var deadline <-chan time.Time
+	if at, ok := ctx.Value(queueDeadlineKey{}).(time.Time); ok {
+		deadline = s.clock.After(at.Sub(s.clock.Now()))
+	}
+
+	select {
+	case <-waiter.ready:
+		return release, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-deadline:
+		err = ErrQueueTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-waiter.ready:
+		// The request was dispatched meanwhile, its turn goes to the next one.
+		s.inFlight--
+		queue.stats.InFlight--
+		s.dispatch()
+	default:
+		for i, w := range queue.waiters {
+			if w == waiter {
+				queue.waiters = append(queue.waiters[:i], queue.waiters[i+1:]...)
+				break
+			}
+		}
+		queue.stats.Queued--
+		queue.stats.Abandoned++
+	}
+	return nil, err
+}
+
+// dispatch lets queued requests go while there is capacity. The lock must be held.
+func (s *PriorityScheduler) dispatch() {
+	for s.maxInFlight <= 0 || s.inFlight < s.maxInFlight {
+		var next *priorityQueue
+		for _, queue := range s.order {
+			if len(queue.waiters) == 0 || queue.class.MaxInFlight > 0 && queue.stats.InFlight >= queue.class.MaxInFlight {
+				continue
+			}
+			if next == nil || queue.pass < next.pass {
+				next = queue
+			}
+		}
+		if next == nil {
+			return
+		}
+
+		waiter := next.waiters[0]
+		next.waiters = next.waiters[1:]
+		s.virtualTime = next.pass
+		next.pass += 1 / float64(next.class.Weight)
+
+		wait := s.clock.Now().Sub(waiter.queuedAt)
+		next.stats.Queued--
+		next.stats.InFlight++
+		next.stats.Served++
+		next.stats.TotalWait += wait
+		next.stats.MaxWait = max(next.stats.MaxWait, wait)
+		s.inFlight++
+		close(waiter.ready)
+	}
+}
+
+// Stats returns the statistics of the scheduler.
+func (s *PriorityScheduler) Stats() PrioritySchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := PrioritySchedulerStats{InFlight: s.inFlight, Classes: make(map[string]PriorityClassStats, len(s.order))}
+	for _, queue := range s.order {
+		stats.Classes[queue.class.Name] = queue.stats
+	}
+	return stats
+}
+
+// Middleware returns a middleware scheduling completions. A streamed completion is in flight until its stream ends,
+// so streams must be consumed or closed.
+func (s *PriorityScheduler) Middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				release, err := s.Acquire(ctx)
+				if err != nil {
+					return nil, err
+				}
+				defer release()
+				return next.CreateCompletion(ctx, args)
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				release, err := s.Acquire(ctx)
+				if err != nil {
+					return ssestream.NewStream[StreamCompletionChunk](nil, err)
+				}
+				stream := next.CreateStreamCompletion(ctx, args)
+				stream.OnDone(func(error) { release() })
+				return stream
+			},
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+)
+
+func TestPriorityScheduler(t *testing.T) {
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	scheduler, err := deepseek.NewPriorityScheduler(deepseek.PrioritySchedulerConfig{
+		Classes: []deepseek.PriorityClass{
+			{Name: "interactive", Weight: 3},
+			{Name: "background", Weight: 1},
+		},
+		MaxInFlight: 1,
+		Clock:       clock,
+	})
+	if err != nil {
+		t.Fatalf("NewPriorityScheduler() error = %v", err)
+	}
+
+	// The queue deadlines of the requests wait on the clock once they are queued, which tells when they are.
+	queued := deepseek.WithQueueDeadline(context.Background(), clock.Now().Add(time.Hour))
+	background := deepseek.WithPriority(queued, "background")
+	interactive := deepseek.WithPriority(queued, "interactive")
+	release, err := scheduler.Acquire(deepseek.WithPriority(context.Background(), "background"))
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// Every request reports its turn and waits to be released, so that they complete in dispatch order.
+	type turn struct {
+		class   string
+		release func()
+	}
+	turns := make(chan turn)
+	var waiters int
+	enqueue := func(ctx context.Context, class string) {
+		go func() {
+			release, err := scheduler.Acquire(ctx)
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			turns <- turn{class: class, release: release}
+		}()
+		waiters++
+		clock.BlockUntil(waiters)
+	}
+	for i := 1; i <= 4; i++ {
+		enqueue(background, "background")
+	}
+	for i := 1; i <= 6; i++ {
+		enqueue(interactive, "interactive")
+	}
+
+	// A request without priority times out in the default class.
+	timedOut := make(chan error)
+	go func() {
+		_, err := scheduler.Acquire(deepseek.WithQueueDeadline(context.Background(), clock.Now().Add(10*time.Millisecond)))
+		timedOut <- err
+	}()
+	clock.BlockUntil(waiters + 1)
+	clock.Advance(10 * time.Millisecond)
+	if err := <-timedOut; !errors.Is(err, deepseek.ErrQueueTimeout) {
+		t.Errorf("Acquire() error = %v; want ErrQueueTimeout", err)
+	}
+
+	release()
+	var order []string
+	for i := 0; i < 10; i++ {
+		turn := <-turns
+		order = append(order, turn.class[:1])
+		turn.release()
+	}
+	if got, want := strings.Join(order, ""), "iiiibiibbb"; got != want {
+		t.Errorf("dispatch order = %s; want %s", got, want)
+	}
+
+	stats := scheduler.Stats()
+	if stats.InFlight != 0 {
+		t.Errorf("InFlight = %d; want 0", stats.InFlight)
+	}
+	if got := stats.Classes["interactive"]; got.Served != 6 || got.Abandoned != 1 || got.Queued != 0 {
+		t.Errorf("interactive stats = %+v", got)
+	}
+	if got := stats.Classes["background"]; got.Served != 5 || got.MaxWait != 10*time.Millisecond {
+		t.Errorf("background stats = %+v", got)
+	}
+}
+
+func TestPrioritySchedulerMiddleware(t *testing.T) {
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	scheduler, err := deepseek.NewPriorityScheduler(deepseek.PrioritySchedulerConfig{
+		Classes:     []deepseek.PriorityClass{{Name: "default", MaxInFlight: 1}},
+		MaxInFlight: 4,
+		Clock:       clock,
+	})
+	if err != nil {
+		t.Fatalf("NewPriorityScheduler() error = %v", err)
+	}
+	chats := scheduler.Middleware()(&fakeChats{content: "Hello!"})
+
+	// The stream holds the only slot of the class until it ends.
+	stream := chats.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{})
+	done := make(chan error)
+	go func() {
+		_, err := chats.CreateCompletion(deepseek.WithQueueDeadline(context.Background(), clock.Now().Add(time.Second)), deepseek.CompletionArgs{})
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if err := <-done; !errors.Is(err, deepseek.ErrQueueTimeout) {
+		t.Fatalf("CreateCompletion() error = %v; want ErrQueueTimeout", err)
+	}
+
+	stream.Close()
+	if _, err := chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{}); err != nil {
+		t.Errorf("CreateCompletion() error = %v", err)
+	}
+}
+
+func TestNewPrioritySchedulerErrors(t *testing.T) {
+	configs := []deepseek.PrioritySchedulerConfig{
+		{},
+		{Classes: []deepseek.PriorityClass{{Name: "a"}, {Name: "a"}}},
+		{Classes: []deepseek.PriorityClass{{Name: "a"}}, DefaultClass: "b"},
+	}
+	for _, config := range configs {
+		if _, err := deepseek.NewPriorityScheduler(config); err == nil {
+			t.Errorf("NewPriorityScheduler(%+v) error = nil", config)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package deepseek
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// QuotaLimit limits the requests, tokens and cost of the requests carrying a tag during a time window.
+type QuotaLimit struct {
+	// Tag is the tag the limit applies to, see WithTags. An empty tag applies the limit to every request.
+	Tag string
+
+	// Window is the duration of the quota window, e.g. time.Minute or 24*time.Hour. Windows are aligned on UTC. It
+	// must be positive.
+	Window time.Duration
+
+	// Requests is the maximum number of requests per window. Zero means no limit.
+	Requests int64
+
+	// Tokens is the maximum number of tokens per window. Zero means no limit.
+	Tokens int64
+
+	// Cost is the maximum cost per window in Currency. Zero means no limit.
+	Cost float64
+
+	// Currency is the currency of Cost. Defaults to USD.
+	Currency Currency
+}
+
+// QuotaUsage is the usage counted against a quota window.
+type QuotaUsage struct {
+	Requests int64   `json:"requests"`
+	Tokens   int64   `json:"tokens"`
+	Cost     float64 `json:"cost"`
+}
+
+// QuotaStore stores the usage of quota windows.
+type QuotaStore interface {
+	// Add atomically adds delta to the usage of key in the window starting at windowStart and returns the resulting usage.
+	Add(ctx context.Context, key string, windowStart time.Time, delta QuotaUsage) (QuotaUsage, error)
+}
+
+// ErrQuotaExceeded is returned when a request would exceed a quota limit.
+type ErrQuotaExceeded struct {
+	// Tag is the tag of the exceeded limit.
+	Tag string
+
+	// Window is the window of the exceeded limit.
+	Window time.Duration
+
+	// Resource is the exceeded resource: "requests", "tokens" or "cost".
+	Resource string
+
+	// Limit is the limit of the resource.
+	Limit float64
+
+	// ResetAt is when the window resets.
+	ResetAt time.Time
+}
+
+func (e *ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("quota exceeded: %s limit of %g per %s for tag %q, resets at %s", e.Resource, e.Limit, e.Window, e.Tag, e.ResetAt.Format(time.RFC3339))
+}
+
+// QuotaEnforcer wraps a ChatService to enforce quota limits before requests are sent.
+//
+// Requests are counted against the limits of the tags carried by their context using their Preflight: the estimated
+// prompt tokens and the MaxTokens they may generate, with their cost. They are then reconciled with the usage reported by the API once they complete, priced for the model which served them.
+type QuotaEnforcer struct {
+	chats  ChatService
+	store  QuotaStore
+	limits []QuotaLimit
+	prices *PriceTable
+	now    func() time.Time
+}
+
+// NewQuotaEnforcer creates a quota enforcer. The usage of quota windows is kept in store.
+func NewQuotaEnforcer(chats ChatService, store QuotaStore, limits ...QuotaLimit) (*QuotaEnforcer, error) {
+	if err := validateQuotaLimits(limits); err != nil {
+		return nil, err
+	}
+	return &QuotaEnforcer{
+		chats:  chats,
+		store:  store,
+		limits: limits,
+		prices: DefaultPrices,
+		now:    time.Now,
+	}, nil
+}
+
+// QuotaMiddleware returns a middleware enforcing the quota limits, see QuotaEnforcer.
+func QuotaMiddleware(store QuotaStore, limits ...QuotaLimit) (ChatMiddleware, error) {
+	if err := validateQuotaLimits(limits); err != nil {
+		return nil, err
+	}
+	return func(next ChatService) ChatService {
+		quotas, _ := NewQuotaEnforcer(next, store, limits...)
+		return quotas
+	}, nil
+}
+
+func validateQuotaLimits(limits []QuotaLimit) error {
+	for _, limit := range limits {
+		if limit.Window <= 0 {
+			return fmt.Errorf("quota limit for tag %q: window must be positive, got %s", limit.Tag, limit.Window)
+		}
+	}
+	return nil
+}
+
+// CreateCompletion creates a chat completion if the quotas allow it.
+func (q *QuotaEnforcer) CreateCompletion(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+	reservation, err := q.reserve(ctx, args.Model, args.Preflight())
+	if err != nil {
+		return nil, err
+	}
+
+	completion, err := q.chats.CreateCompletion(ctx, args)
+	var usage CompletionUsage
+	model := args.Model
+	if completion != nil {
+		usage, model = completion.Usage, servedModel(args.Model, completion.Model)
+	}
+	q.reconcile(ctx, reservation, model, usage)
+	return completion, err
+}
+
+// CreateStreamCompletion streams a chat completion if the quotas allow it. Quota errors are reported by the Err method of the returned stream.
+func (q *QuotaEnforcer) CreateStreamCompletion(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+	reservation, err := q.reserve(ctx, args.Model, args.Preflight())
+	if err != nil {
+		return ssestream.NewStream[StreamCompletionChunk](nil, err)
+	}
+
+	stream := q.chats.CreateStreamCompletion(ctx, args)
+	var acc StreamAccumulator
+	var received bool
+	stream.OnChunk(func(chunk StreamCompletionChunk) {
+		received = true
+		acc.Add(chunk)
+	})
+	stream.OnDone(func(error) {
+		// Streams failing before their first chunk count no tokens.
+		usage, ok := acc.Usage()
+		if !ok && received {
+			usage = estimateStreamUsage(args, &acc)
+		}
+		q.reconcile(ctx, reservation, servedModel(args.Model, acc.Response().Model), usage)
+	})
+	return stream
+}
+
+// quotaReservation is the usage counted against the quota windows before a request is sent.
+type quotaReservation struct {
+	model     ModelID
+	at        time.Time
+	estimated CompletionUsage
+	windows   []quotaWindow
+}
+
+type quotaWindow struct {
+	limit QuotaLimit
+	key   string
+	start time.Time
+}
+
+// reserve counts a request against every applicable quota window, rolling back when a limit would be exceeded.
+func (q *QuotaEnforcer) reserve(ctx context.Context, model ModelID, preflight Preflight) (*quotaReservation, error) {
+	now := q.now()
+	tags := TagsFromContext(ctx)
+	estimated := CompletionUsage{
+		PromptTokens:     preflight.PromptTokens,
+		CompletionTokens: preflight.MaxTokens,
+		TotalTokens:      preflight.PromptTokens + preflight.MaxTokens,
+	}
+	reservation := &quotaReservation{model: model, at: now, estimated: estimated}
+
+	for _, limit := range q.limits {
+		if limit.Tag != "" && !containsTag(tags, limit.Tag) {
+			continue
+		}
+
+		window := quotaWindow{
+			limit: limit,
+			key:   fmt.Sprintf("%s|%s", limit.Tag, limit.Window),
+			start: now.UTC().Truncate(limit.Window),
+		}
+		delta := QuotaUsage{
+			Requests: 1,
+			Tokens:   estimated.TotalTokens,
+			Cost:     q.cost(estimated, model, now, limit.Currency),
+		}
+
+		usage, err := q.store.Add(ctx, window.key, window.start, delta)
+		if err != nil {
+			q.rollback(ctx, reservation)
+			return nil, err
+		}
+		reservation.windows = append(reservation.windows, window)
+
+		if exceeded := exceededResource(limit, usage); exceeded != "" {
+			q.rollback(ctx, reservation)
+			return nil, &ErrQuotaExceeded{
+				Tag:      limit.Tag,
+				Window:   limit.Window,
+				Resource: exceeded,
+				Limit:    limitOf(limit, exceeded),
+				ResetAt:  window.start.Add(limit.Window),
+			}
+		}
+	}
+	return reservation, nil
+}
+
+func (q *QuotaEnforcer) rollback(ctx context.Context, reservation *quotaReservation) {
+	for _, window := range reservation.windows {
+		delta := QuotaUsage{
+			Requests: -1,
+			Tokens:   -reservation.estimated.TotalTokens,
+			Cost:     -q.cost(reservation.estimated, reservation.model, reservation.at, window.limit.Currency),
+		}
+		_, _ = q.store.Add(ctx, window.key, window.start, delta)
+	}
+}
+
+// reconcile replaces the estimated usage counted by reserve with the actual usage of the request, served by model.
+func (q *QuotaEnforcer) reconcile(ctx context.Context, reservation *quotaReservation, model ModelID, usage CompletionUsage) {
+	estimated := reservation.estimated
+	for _, window := range reservation.windows {
+		currency := window.limit.Currency
+		delta := QuotaUsage{
+			Tokens: usage.PromptTokens + usage.CompletionTokens - estimated.TotalTokens,
+			Cost:   q.cost(usage, model, reservation.at, currency) - q.cost(estimated, reservation.model, reservation.at, currency),
+		}
+		// The context of the request may be done by now but the usage must still be accounted for.
+		_, _ = q.store.Add(context.WithoutCancel(ctx), window.key, window.start, delta)
+	}
+}
+
+func (q *QuotaEnforcer) cost(usage CompletionUsage, model ModelID, at time.Time, currency Currency) float64 {
+	if currency == "" {
+		currency = USD
+	}
+	return q.prices.Cost(usage, model, at).In(currency)
+}
+
+// exceededResource returns the resource of usage exceeding the limit, if any.
+func exceededResource(limit QuotaLimit, usage QuotaUsage) string {
+	switch {
+	case limit.Requests > 0 && usage.Requests > limit.Requests:
+		return "requests"
+	case limit.Tokens > 0 && usage.Tokens > limit.Tokens:
+		return "tokens"
+	case limit.Cost > 0 && usage.Cost > limit.Cost:
+		return "cost"
+	default:
+		return ""
+	}
+}
+
+func limitOf(limit QuotaLimit, resource string) float64 {
+	switch resource {
+	case "requests":
+		return float64(limit.Requests)
+	case "tokens":
+		return float64(limit.Tokens)
+	default:
+		return limit.Cost
+	}
+}
+
+// MemoryQuotaStore keeps the usage of quota windows in memory. Only the current window of each key is retained.
+type MemoryQuotaStore struct {
+	mu      sync.Mutex
+	windows map[string]memoryQuotaWindow
+}
+
+type memoryQuotaWindow struct {
+	start time.Time
+	usage QuotaUsage
+}
+
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{windows: map[string]memoryQuotaWindow{}}
+}
+
+func (s *MemoryQuotaStore) Add(_ context.Context, key string, windowStart time.Time, delta QuotaUsage) (QuotaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	window := s.windows[key]
+	switch {
+	case window.start.Before(windowStart):
+		window = memoryQuotaWindow{start: windowStart}
+	case windowStart.Before(window.start):
+		// Late reconciliation of a past window, which has already been discarded.
+		return QuotaUsage{}, nil
+	}
+
+	window.usage.Requests += delta.Requests
+	window.usage.Tokens += delta.Tokens
+	window.usage.Cost += delta.Cost
+	s.windows[key] = window
+	return window.usage, nil
+}
@@ -0,0 +1,117 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+func TestQuotaEnforcer(t *testing.T) {
+	server := newCompletionServer(t)
+	client, err := deepseek.NewClient("api-key", deepseek.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	quotas, err := deepseek.NewQuotaEnforcer(client.Chats, deepseek.NewMemoryQuotaStore(),
+		deepseek.QuotaLimit{Tag: "team:search", Window: time.Minute, Requests: 2},
+		deepseek.QuotaLimit{Tag: "team:ads", Window: 24 * time.Hour, Tokens: 16},
+	)
+	if err != nil {
+		t.Fatalf("NewQuotaEnforcer() error = %v", err)
+	}
+	args := deepseek.CompletionArgs{
+		Model:     deepseek.DeepSeekChat,
+		Messages:  []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+		MaxTokens: 8,
+	}
+
+	search := deepseek.WithTags(context.Background(), "team:search")
+	for i := 0; i < 2; i++ {
+		if _, err := quotas.CreateCompletion(search, args); err != nil {
+			t.Fatalf("CreateCompletion() #%d error = %v", i, err)
+		}
+	}
+
+	_, err = quotas.CreateCompletion(search, args)
+	var exceeded *deepseek.ErrQuotaExceeded
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("CreateCompletion() error = %v; want ErrQuotaExceeded", err)
+	}
+	if exceeded.Resource != "requests" || exceeded.Tag != "team:search" {
+		t.Errorf("ErrQuotaExceeded = %+v", exceeded)
+	}
+	if !exceeded.ResetAt.After(time.Now()) || exceeded.ResetAt.After(time.Now().Add(time.Minute)) {
+		t.Errorf("ResetAt = %s; want within the next minute", exceeded.ResetAt)
+	}
+
+	// The tokens the model may generate are reserved, the default MaxTokens of the model exceeds the quota.
+	ads := deepseek.WithTags(context.Background(), "team:ads")
+	unbounded := args
+	unbounded.MaxTokens = 0
+	if _, err := quotas.CreateCompletion(ads, unbounded); !errors.As(err, &exceeded) || exceeded.Resource != "tokens" {
+		t.Fatalf("CreateCompletion() error = %v; want tokens ErrQuotaExceeded", err)
+	}
+
+	// The first request is reconciled with its actual usage of 15 tokens, leaving no room for a second one.
+	if _, err := quotas.CreateCompletion(ads, args); err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+	stream := quotas.CreateStreamCompletion(ads, deepseek.StreamCompletionArgs{Model: args.Model, Messages: args.Messages, MaxTokens: args.MaxTokens})
+	if stream.Next() {
+		t.Fatalf("Next() = true; want the stream to fail")
+	}
+	if !errors.As(stream.Err(), &exceeded) || exceeded.Resource != "tokens" {
+		t.Errorf("Err() = %v; want tokens ErrQuotaExceeded", stream.Err())
+	}
+
+	// Untagged requests aren't limited.
+	if _, err := quotas.CreateCompletion(context.Background(), args); err != nil {
+		t.Errorf("CreateCompletion() without tags error = %v", err)
+	}
+}
+
+func TestQuotaEnforcerFailedStream(t *testing.T) {
+	chats := deepseek.ChatFuncs{
+		StreamFunc: func(context.Context, deepseek.StreamCompletionArgs) *ssestream.Stream[deepseek.StreamCompletionChunk] {
+			return ssestream.NewStream[deepseek.StreamCompletionChunk](nil, deepseek.ErrServiceUnavailable)
+		},
+	}
+	quotas, err := deepseek.NewQuotaEnforcer(chats, deepseek.NewMemoryQuotaStore(),
+		deepseek.QuotaLimit{Tag: "team:ads", Window: 24 * time.Hour, Tokens: 16},
+	)
+	if err != nil {
+		t.Fatalf("NewQuotaEnforcer() error = %v", err)
+	}
+
+	// Streams failing before their first chunk count no tokens, however many fail.
+	ads := deepseek.WithTags(context.Background(), "team:ads")
+	args := deepseek.StreamCompletionArgs{
+		Model:     deepseek.DeepSeekChat,
+		Messages:  []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+		MaxTokens: 8,
+	}
+	for i := 0; i < 3; i++ {
+		stream := quotas.CreateStreamCompletion(ads, args)
+		for stream.Next() {
+		}
+		stream.Close()
+		if err := stream.Err(); !errors.Is(err, deepseek.ErrServiceUnavailable) {
+			t.Fatalf("Err() #%d = %v; want ErrServiceUnavailable", i, err)
+		}
+	}
+}
+
+func TestQuotaEnforcerInvalidWindow(t *testing.T) {
+	limit := deepseek.QuotaLimit{Tag: "team:search", Requests: 2}
+	if _, err := deepseek.NewQuotaEnforcer(nil, deepseek.NewMemoryQuotaStore(), limit); err == nil {
+		t.Errorf("NewQuotaEnforcer() without window error = nil")
+	}
+	if _, err := deepseek.QuotaMiddleware(deepseek.NewMemoryQuotaStore(), limit); err == nil {
+		t.Errorf("QuotaMiddleware() without window error = nil")
+	}
+}
@@ -0,0 +1,315 @@
+package deepseek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// RateLimitMode defines what a RateLimiter does with requests exceeding the limits.
+type RateLimitMode int
+
+const (
+	// RateLimitBlock makes requests wait until they are allowed or their context is done.
+	RateLimitBlock RateLimitMode = iota
+
+	// RateLimitFailFast rejects requests with ErrRateLimited.
+	RateLimitFailFast
+)
+
+// RateLimitConfig configures a RateLimiter.
+type RateLimitConfig struct {
+	// RequestsPerMinute is the maximum number of requests per minute. Zero means no limit.
+	RequestsPerMinute int
+
+	// TokensPerMinute is the maximum number of tokens per minute. Zero means no limit.
+	//
+	// Requests are counted with their estimated prompt tokens and MaxTokens before being sent, corrected with their
+	// actual usage once completed.
+	TokensPerMinute int
+
+	// Mode defaults to RateLimitBlock.
+	Mode RateLimitMode
+
+	// BackoffFactor multiplies the allowed rates every time the API responds with ErrRateLimitExceeded. Defaults to 0.5.
+	BackoffFactor float64
+
+	// MinRateFactor is the lowest fraction of the configured rates the backoff can go down to. Defaults to 0.1.
+	MinRateFactor float64
+
+	// RecoveryPeriod is how long the rates take to recover linearly after a backoff. Defaults to 1 minute.
+	RecoveryPeriod time.Duration
+
+	// Clock defaults to SystemClock.
+	Clock Clock
+}
+
+// ErrRateLimited is returned by a fail-fast RateLimiter when a request exceeds the limits. It matches ErrRateLimitExceeded
+// with errors.Is so that both local and API rate limits can be handled alike.
+type ErrRateLimited struct {
+	// Resource is the exhausted resource: "requests" or "tokens".
+	Resource string
+
+	// RetryAfter is the estimated wait before the request is allowed.
+	RetryAfter time.Duration
+}
+
+func (e *ErrRateLimited) Error() string {
+	return fmt.Sprintf("client rate limit of %s reached, retry after %s", e.Resource, e.RetryAfter)
+}
+
+func (e *ErrRateLimited) Is(target error) bool {
+	return target == ErrRateLimitExceeded
+}
+
+// RateLimitStats are statistics of a RateLimiter.
+type RateLimitStats struct {
+	// Allowed is the number of requests allowed.
+	Allowed int64
+
+	// Rejected is the number of requests rejected in fail-fast mode or whose context was done while waiting.
+	Rejected int64
+
+	// Waited is the cumulated wait of blocked requests.
+	Waited time.Duration
+
+	// Backoffs is the number of rate limit errors from the API that reduced the rates.
+	Backoffs int64
+
+	// RateFactor is the current fraction of the configured rates allowed, below 1 after a backoff.
+	RateFactor float64
+}
+
+// RateLimiter limits the rate of requests and tokens with token buckets, see WithRateLimit.
+type RateLimiter struct {
+	config RateLimitConfig
+
+	mu       sync.Mutex
+	requests rateBucket
+	tokens   rateBucket
+	updated  time.Time
+	// The rates are reduced to factor after a backoff at backoffAt, and recover over the recovery period.
+	factor    float64
+	backoffAt time.Time
+	stats     RateLimitStats
+}
+
+// rateBucket is a token bucket holding up to a minute of its rate.
+type rateBucket struct {
+	perMinute float64
+	level     float64
+}
+
+// NewRateLimiter creates a rate limiter.
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	if config.BackoffFactor <= 0 || config.BackoffFactor >= 1 {
+		config.BackoffFactor = 0.5
+	}
+	if config.MinRateFactor <= 0 || config.MinRateFactor > 1 {
+		config.MinRateFactor = 0.1
+	}
+	if config.RecoveryPeriod <= 0 {
+		config.RecoveryPeriod = time.Minute
+	}
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+	return &RateLimiter{
+		config:   config,
+		requests: rateBucket{perMinute: float64(config.RequestsPerMinute), level: float64(config.RequestsPerMinute)},
+		tokens:   rateBucket{perMinute: float64(config.TokensPerMinute), level: float64(config.TokensPerMinute)},
+		updated:  config.Clock.Now(),
+		factor:   1,
+	}
+}
+
+// Wait takes a request and tokens from the limiter, waiting until they are available in blocking mode.
+//
+// A request of more tokens than the per-minute limit is allowed once the bucket is full.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int64) error {
+	var waited time.Duration
+	for {
+		resource, wait := l.take(float64(tokens))
+		if wait == 0 {
+			l.mu.Lock()
+			l.stats.Allowed++
+			l.stats.Waited += waited
+			l.mu.Unlock()
+			return nil
+		}
+
+		if l.config.Mode == RateLimitFailFast {
+			l.reject()
+			return &ErrRateLimited{Resource: resource, RetryAfter: wait}
+		}
+		select {
+		case <-l.config.Clock.After(wait):
+			waited += wait
+		case <-ctx.Done():
+			l.reject()
+			return ctx.Err()
+		}
+	}
+}
+
+// Adjust corrects the tokens taken by Wait for a request with its actual usage. The difference can be negative.
+func (l *RateLimiter) Adjust(tokens int64) {
+	if l.tokens.perMinute == 0 || tokens == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.tokens.level = min(l.tokens.level-float64(tokens), l.tokens.perMinute)
+}
+
+// Backoff reduces the allowed rates after the API rate limited a request and empties the buckets.
+func (l *RateLimiter) Backoff() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.factor = max(l.rateFactor(l.updated)*l.config.BackoffFactor, l.config.MinRateFactor)
+	l.backoffAt = l.updated
+	l.requests.level = min(l.requests.level, 0)
+	l.tokens.level = min(l.tokens.level, 0)
+	l.stats.Backoffs++
+}
+
+// Stats returns the statistics of the limiter.
+func (l *RateLimiter) Stats() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	stats.RateFactor = l.rateFactor(l.config.Clock.Now())
+	return stats
+}
+
+// Middleware returns a middleware applying the limiter to completions. Rate limit errors from the API trigger a backoff.
+//
+// The tokens of a request are estimated with its Preflight, counting the default MaxTokens of its model when not set,
+// then adjusted with its actual usage.
+func (l *RateLimiter) Middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				preflight := args.Preflight()
+				estimated := preflight.PromptTokens + preflight.MaxTokens
+				if err := l.Wait(ctx, estimated); err != nil {
+					return nil, err
+				}
+
+				completion, err := next.CreateCompletion(ctx, args)
+				l.observe(err)
+				if completion != nil {
+					l.Adjust(completion.Usage.TotalTokens - estimated)
+				} else {
+					// Failed requests don't consume tokens.
+					l.Adjust(-estimated)
+				}
+				return completion, err
+			},
+			StreamFunc: func(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk] {
+				preflight := args.Preflight()
+				estimated := preflight.PromptTokens + preflight.MaxTokens
+				if err := l.Wait(ctx, estimated); err != nil {
+					return ssestream.NewStream[StreamCompletionChunk](nil, err)
+				}
+
+				stream := next.CreateStreamCompletion(ctx, args)
+				var acc StreamAccumulator
+				var received bool
+				stream.OnChunk(func(chunk StreamCompletionChunk) {
+					received = true
+					acc.Add(chunk)
+				})
+				stream.OnDone(func(err error) {
+					l.observe(err)
+					usage, ok := acc.Usage()
+					if !ok && received {
+						usage = estimateStreamUsage(args, &acc)
+					}
+					// Streams failing before their first chunk don't consume tokens.
+					l.Adjust(usage.TotalTokens - estimated)
+				})
+				return stream
+			},
+		}
+	}
+}
+
+// observe backs off when err is a rate limit error from the API.
+func (l *RateLimiter) observe(err error) {
+	var limited *ErrRateLimited
+	if errors.Is(err, ErrRateLimitExceeded) && !errors.As(err, &limited) {
+		l.Backoff()
+	}
+}
+
+func (l *RateLimiter) reject() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Rejected++
+}
+
+// take takes a request and tokens from the buckets, or returns the exhausted resource and how long to wait for it.
+func (l *RateLimiter) take(tokens float64) (string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+
+	if l.requests.perMinute > 0 && l.requests.level < 1 {
+		return "requests", l.requests.wait(1, l.rateFactor(l.updated))
+	}
+	if l.tokens.perMinute > 0 {
+		if need := min(tokens, l.tokens.perMinute); l.tokens.level < need {
+			return "tokens", l.tokens.wait(need, l.rateFactor(l.updated))
+		}
+	}
+
+	if l.requests.perMinute > 0 {
+		l.requests.level--
+	}
+	if l.tokens.perMinute > 0 {
+		l.tokens.level -= tokens
+	}
+	return "", 0
+}
+
+// refill fills the buckets for the time elapsed since the last refill.
+func (l *RateLimiter) refill() {
+	now := l.config.Clock.Now()
+	elapsed := now.Sub(l.updated)
+	if elapsed <= 0 {
+		return
+	}
+	// The factor is averaged over the elapsed time, as it recovers linearly.
+	factor := (l.rateFactor(l.updated) + l.rateFactor(now)) / 2
+	l.requests.fill(elapsed, factor)
+	l.tokens.fill(elapsed, factor)
+	l.updated = now
+}
+
+// rateFactor returns the fraction of the configured rates allowed at the given time.
+func (l *RateLimiter) rateFactor(at time.Time) float64 {
+	if l.factor >= 1 {
+		return 1
+	}
+	recovered := float64(at.Sub(l.backoffAt)) / float64(l.config.RecoveryPeriod)
+	return min(1, l.factor+(1-l.factor)*max(recovered, 0))
+}
+
+func (b *rateBucket) fill(elapsed time.Duration, factor float64) {
+	b.level = min(b.level+b.perMinute*factor*elapsed.Minutes(), b.perMinute)
+}
+
+// wait returns how long the bucket takes to hold n at the given rate factor.
+func (b *rateBucket) wait(n, factor float64) time.Duration {
+	minutes := (n - b.level) / (b.perMinute * factor)
+	return max(time.Duration(math.Ceil(minutes*float64(time.Minute))), time.Millisecond)
+}
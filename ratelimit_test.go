@@ -0,0 +1,157 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+	"github.com/roushou/deepseek/packages/deepseektest"
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+func TestRateLimiterFailFast(t *testing.T) {
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	limiter := deepseek.NewRateLimiter(deepseek.RateLimitConfig{
+		RequestsPerMinute: 2,
+		TokensPerMinute:   100,
+		Mode:              deepseek.RateLimitFailFast,
+		Clock:             clock,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Wait(ctx, 10); err != nil {
+			t.Fatalf("Wait() #%d error = %v", i, err)
+		}
+	}
+	err := limiter.Wait(ctx, 10)
+	var limited *deepseek.ErrRateLimited
+	if !errors.As(err, &limited) || limited.Resource != "requests" || limited.RetryAfter != 30*time.Second {
+		t.Fatalf("Wait() error = %v; want requests ErrRateLimited retrying after 30s", err)
+	}
+	if !errors.Is(err, deepseek.ErrRateLimitExceeded) {
+		t.Errorf("errors.Is(%v, ErrRateLimitExceeded) = false", err)
+	}
+
+	// The actual usage of the requests exhausts the tokens.
+	clock.Advance(30 * time.Second)
+	limiter.Adjust(130)
+	err = limiter.Wait(ctx, 10)
+	if !errors.As(err, &limited) || limited.Resource != "tokens" {
+		t.Fatalf("Wait() error = %v; want tokens ErrRateLimited", err)
+	}
+	clock.Advance(limited.RetryAfter)
+	if err := limiter.Wait(ctx, 10); err != nil {
+		t.Errorf("Wait() after %s error = %v", limited.RetryAfter, err)
+	}
+
+	if stats := limiter.Stats(); stats.Allowed != 3 || stats.Rejected != 2 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestRateLimiterBlock(t *testing.T) {
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	limiter := deepseek.NewRateLimiter(deepseek.RateLimitConfig{RequestsPerMinute: 1, Clock: clock})
+	if err := limiter.Wait(context.Background(), 0); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- limiter.Wait(context.Background(), 0) }()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- limiter.Wait(ctx, 0) }()
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() error = %v; want context.Canceled", err)
+	}
+}
+
+func TestRateLimiterBackoff(t *testing.T) {
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	limiter := deepseek.NewRateLimiter(deepseek.RateLimitConfig{
+		RequestsPerMinute: 60,
+		Mode:              deepseek.RateLimitFailFast,
+		Clock:             clock,
+	})
+	chats := limiter.Middleware()(&fakeChats{err: deepseek.ErrRateLimitExceeded})
+
+	if _, err := chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{Model: deepseek.DeepSeekChat}); !errors.Is(err, deepseek.ErrRateLimitExceeded) {
+		t.Fatalf("CreateCompletion() error = %v; want ErrRateLimitExceeded", err)
+	}
+	if stats := limiter.Stats(); stats.Backoffs != 1 || stats.RateFactor != 0.5 {
+		t.Errorf("Stats() = %+v; want one backoff halving the rates", stats)
+	}
+
+	// The buckets are emptied and refill at half the rate.
+	var limited *deepseek.ErrRateLimited
+	if _, err := chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{}); !errors.As(err, &limited) {
+		t.Fatalf("CreateCompletion() error = %v; want ErrRateLimited", err)
+	}
+	if limited.RetryAfter != 2*time.Second {
+		t.Errorf("RetryAfter = %s; want 2s", limited.RetryAfter)
+	}
+	if stats := limiter.Stats(); stats.Backoffs != 1 {
+		t.Errorf("Backoffs = %d; want local rate limits not to back off", stats.Backoffs)
+	}
+
+	clock.Advance(time.Minute)
+	if stats := limiter.Stats(); stats.RateFactor != 1 {
+		t.Errorf("RateFactor = %g; want the rates recovered", stats.RateFactor)
+	}
+}
+
+func TestRateLimiterMiddlewareReservesMaxTokens(t *testing.T) {
+	clock := deepseektest.NewClock(time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC))
+	limiter := deepseek.NewRateLimiter(deepseek.RateLimitConfig{TokensPerMinute: 4200, Mode: deepseek.RateLimitFailFast, Clock: clock})
+
+	// The default MaxTokens of the model is reserved while the request is in flight.
+	chats := limiter.Middleware()(deepseek.ChatFuncs{
+		CompleteFunc: func(ctx context.Context, args deepseek.CompletionArgs) (*deepseek.CompletionResponse, error) {
+			var limited *deepseek.ErrRateLimited
+			if err := limiter.Wait(ctx, 200); !errors.As(err, &limited) || limited.Resource != "tokens" {
+				t.Errorf("Wait() during the request error = %v; want tokens ErrRateLimited", err)
+			}
+			return &deepseek.CompletionResponse{Usage: deepseek.CompletionUsage{TotalTokens: 10}}, nil
+		},
+	})
+	_, err := chats.CreateCompletion(context.Background(), deepseek.CompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletion() error = %v", err)
+	}
+
+	// The unused tokens are given back once the usage is known.
+	if err := limiter.Wait(context.Background(), 200); err != nil {
+		t.Errorf("Wait() after the request error = %v", err)
+	}
+
+	// Streams failing before their first chunk give back all the tokens.
+	clock.Advance(time.Minute)
+	streams := limiter.Middleware()(deepseek.ChatFuncs{
+		StreamFunc: func(context.Context, deepseek.StreamCompletionArgs) *ssestream.Stream[deepseek.StreamCompletionChunk] {
+			return ssestream.NewStream[deepseek.StreamCompletionChunk](nil, deepseek.ErrServiceUnavailable)
+		},
+	})
+	stream := streams.CreateStreamCompletion(context.Background(), deepseek.StreamCompletionArgs{
+		Model:    deepseek.DeepSeekChat,
+		Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}},
+	})
+	for stream.Next() {
+	}
+	stream.Close()
+	if err := limiter.Wait(context.Background(), 4200); err != nil {
+		t.Errorf("Wait() after a failed stream error = %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package deepseek
+
+import (
+	"context"
+
+	"github.com/roushou/deepseek/packages/ssestream"
+)
+
+// ChatCompleter creates chat completions.
+type ChatCompleter interface {
+	CreateCompletion(ctx context.Context, args CompletionArgs) (*CompletionResponse, error)
+}
+
+// ChatStreamer streams chat completions.
+type ChatStreamer interface {
+	CreateStreamCompletion(ctx context.Context, args StreamCompletionArgs) *ssestream.Stream[StreamCompletionChunk]
+}
+
+// ChatService creates and streams chat completions. It is implemented by ChatsClient and by the middlewares decorating it.
+type ChatService interface {
+	ChatCompleter
+	ChatStreamer
+}
+
+// ModelLister lists and retrieves models.
+type ModelLister interface {
+	ListModels() (*ModelsList, error)
+	GetModel(modelID string) (*Model, error)
+}
+
+// BalanceGetter retrieves the balance of the account.
+type BalanceGetter interface {
+	GetUserBalance() (*UserBalanceResponse, error)
+}
+
+var (
+	_ ChatService   = (*ChatsClient)(nil)
+	_ ModelLister   = (*ModelsClient)(nil)
+	_ BalanceGetter = (*BalancesClient)(nil)
+)
@@ -0,0 +1,136 @@
+package deepseek
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SingleflightStats are statistics of a Singleflight.
+type SingleflightStats struct {
+	// Calls is the number of requests sent.
+	Calls int64
+
+	// Shared is the number of requests answered by the call of an identical request in flight.
+	Shared int64
+
+	// Canceled is the number of calls canceled because every caller waiting for them gave up.
+	Canceled int64
+}
+
+// Singleflight collapses concurrent identical completions into a single request whose response is shared with every
+// caller, see WithSingleflight.
+//
+// The shared request isn't bound to the context of the caller that started it: it is canceled once the contexts of
+// every caller waiting for it are done. Requests are identical when their CacheKey and their tags are, so that the
+// shared request is attributed to the tags of each of its callers, e.g. by a Ledger. Streams aren't collapsed.
+type Singleflight struct {
+	mu    sync.Mutex
+	calls map[string]*singleflightCall
+	stats SingleflightStats
+}
+
+type singleflightCall struct {
+	done     chan struct{}
+	response *CompletionResponse
+	err      error
+	waiters  int
+	cancel   context.CancelFunc
+}
+
+// NewSingleflight creates a Singleflight.
+func NewSingleflight() *Singleflight {
+	return &Singleflight{calls: make(map[string]*singleflightCall)}
+}
+
+// Stats returns the statistics of the singleflight.
+func (s *Singleflight) Stats() SingleflightStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Middleware returns a middleware collapsing identical completions.
+func (s *Singleflight) Middleware() ChatMiddleware {
+	return func(next ChatService) ChatService {
+		return ChatFuncs{
+			Next: next,
+			CompleteFunc: func(ctx context.Context, args CompletionArgs) (*CompletionResponse, error) {
+				key, err := CacheKey(args)
+				if err != nil {
+					return next.CreateCompletion(ctx, args)
+				}
+				tags := slices.Sorted(slices.Values(TagsFromContext(ctx)))
+				key += "\x00" + strings.Join(tags, "\x00")
+				return s.do(ctx, key, func(ctx context.Context) (*CompletionResponse, error) {
+					return next.CreateCompletion(ctx, args)
+				})
+			},
+		}
+	}
+}
+
+func (s *Singleflight) do(ctx context.Context, key string, fn func(ctx context.Context) (*CompletionResponse, error)) (*CompletionResponse, error) {
+	s.mu.Lock()
+	call, ok := s.calls[key]
+	if ok {
+		s.stats.Shared++
+	} else {
+		// The values of the context, e.g. tags, are kept but its cancellation is replaced by the reference count.
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &singleflightCall{done: make(chan struct{}), cancel: cancel}
+		s.calls[key] = call
+		s.stats.Calls++
+		go s.run(callCtx, key, call, fn)
+	}
+	call.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, call.err
+		}
+		// Every caller gets its own copy, so that one modifying the response doesn't affect the others.
+		response := *call.response
+		response.Choices = slices.Clone(response.Choices)
+		for i := range response.Choices {
+			response.Choices[i].Message.ToolCalls = slices.Clone(response.Choices[i].Message.ToolCalls)
+		}
+		return &response, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		call.waiters--
+		if call.waiters == 0 {
+			select {
+			case <-call.done:
+			default:
+				call.cancel()
+				s.forget(key, call)
+				s.stats.Canceled++
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Singleflight) run(ctx context.Context, key string, call *singleflightCall, fn func(ctx context.Context) (*CompletionResponse, error)) {
+	response, err := fn(ctx)
+
+	s.mu.Lock()
+	s.forget(key, call)
+	s.mu.Unlock()
+
+	call.response, call.err = response, err
+	close(call.done)
+	call.cancel()
+}
+
+// forget removes a call so that the next identical request starts a new one. The lock must be held.
+func (s *Singleflight) forget(key string, call *singleflightCall) {
+	if s.calls[key] == call {
+		delete(s.calls, key)
+	}
+}
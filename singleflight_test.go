@@ -0,0 +1,177 @@
+package deepseek_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/roushou/deepseek"
+)
+
+// gatedChats answers completions once the gate is opened, or fails when their context is done.
+type gatedChats struct {
+	fakeChats
+	gate     chan struct{}
+	calls    atomic.Int64
+	canceled chan struct{}
+}
+
+func (g *gatedChats) CreateCompletion(ctx context.Context, args deepseek.CompletionArgs) (*deepseek.CompletionResponse, error) {
+	g.calls.Add(1)
+	select {
+	case <-g.gate:
+		return g.fakeChats.CreateCompletion(ctx, args)
+	case <-ctx.Done():
+		close(g.canceled)
+		return nil, ctx.Err()
+	}
+}
+
+func newGatedChats() *gatedChats {
+	return &gatedChats{fakeChats: fakeChats{content: "Hello!"}, gate: make(chan struct{}), canceled: make(chan struct{})}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSingleflight(t *testing.T) {
+	upstream := newGatedChats()
+	singleflight := deepseek.NewSingleflight()
+	chats := singleflight.Middleware()(upstream)
+	args := deepseek.CompletionArgs{Model: deepseek.DeepSeekChat, Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}}}
+
+	// The caller starting the call gives up, the others still get the response.
+	first, cancelFirst := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		ctx := context.Background()
+		if i == 0 {
+			ctx = first
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			completion, err := chats.CreateCompletion(ctx, args)
+			if err == nil && completion.Choices[0].Message.Content != "Hello!" {
+				err = errors.New("unexpected content")
+			}
+			results <- err
+		}()
+		waitFor(t, func() bool { return singleflight.Stats().Calls+singleflight.Stats().Shared == int64(i+1) })
+	}
+	cancelFirst()
+	if err := <-results; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first caller error = %v; want context.Canceled", err)
+	}
+
+	close(upstream.gate)
+	wg.Wait()
+	close(results)
+	for err := range results {
+		if err != nil {
+			t.Errorf("CreateCompletion() error = %v", err)
+		}
+	}
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d; want 1", got)
+	}
+	if stats := singleflight.Stats(); stats.Calls != 1 || stats.Shared != 2 || stats.Canceled != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestSingleflightCancel(t *testing.T) {
+	upstream := newGatedChats()
+	singleflight := deepseek.NewSingleflight()
+	chats := singleflight.Middleware()(upstream)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := chats.CreateCompletion(ctx, deepseek.CompletionArgs{Model: deepseek.DeepSeekChat})
+			done <- err
+		}()
+	}
+	waitFor(t, func() bool { return singleflight.Stats().Shared == 1 })
+
+	// The call is canceled once every caller gave up.
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("CreateCompletion() error = %v; want context.Canceled", err)
+		}
+	}
+	select {
+	case <-upstream.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("upstream call not canceled")
+	}
+	if stats := singleflight.Stats(); stats.Canceled != 1 {
+		t.Errorf("Stats() = %+v; want one canceled call", stats)
+	}
+}
+
+func TestSingleflightTags(t *testing.T) {
+	gate := make(chan struct{})
+	var calls atomic.Int64
+	singleflight := deepseek.NewSingleflight()
+	chats := singleflight.Middleware()(deepseek.ChatFuncs{
+		CompleteFunc: func(ctx context.Context, args deepseek.CompletionArgs) (*deepseek.CompletionResponse, error) {
+			calls.Add(1)
+			<-gate
+			call := deepseek.CompletionToolCall{ID: "1", Type: deepseek.ToolFunctionType, Function: deepseek.CompletionToolCallFunction{Name: "search"}}
+			return &deepseek.CompletionResponse{
+				Choices: []deepseek.CompletionChoice{{Message: deepseek.Message{Role: deepseek.AssistantRole, ToolCalls: []deepseek.CompletionToolCall{call}}}},
+			}, nil
+		},
+	})
+	args := deepseek.CompletionArgs{Model: deepseek.DeepSeekChat, Messages: []deepseek.Message{{Role: deepseek.UserRole, Content: "Hello"}}}
+
+	// Identical requests are only collapsed with the same tags, whatever their order.
+	contexts := []context.Context{
+		deepseek.WithTags(context.Background(), "team:search", "env:prod"),
+		deepseek.WithTags(context.Background(), "env:prod", "team:search"),
+		deepseek.WithTags(context.Background(), "team:ads"),
+	}
+	responses := make([]*deepseek.CompletionResponse, len(contexts))
+	var wg sync.WaitGroup
+	for i, ctx := range contexts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := chats.CreateCompletion(ctx, args)
+			if err != nil {
+				t.Errorf("CreateCompletion() error = %v", err)
+			}
+			responses[i] = response
+		}()
+		waitFor(t, func() bool { return singleflight.Stats().Calls+singleflight.Stats().Shared == int64(i+1) })
+	}
+	close(gate)
+	wg.Wait()
+	if stats := singleflight.Stats(); stats.Calls != 2 || stats.Shared != 1 || calls.Load() != 2 {
+		t.Errorf("Stats() = %+v, upstream calls = %d; want 2 calls and 1 shared", stats, calls.Load())
+	}
+
+	// Callers sharing a response get their own tool calls.
+	if t.Failed() {
+		return
+	}
+	responses[0].Choices[0].Message.ToolCalls[0].Function.Name = "changed"
+	if name := responses[1].Choices[0].Message.ToolCalls[0].Function.Name; name != "search" {
+		t.Errorf("shared tool call name = %q; want %q", name, "search")
+	}
+}
@@ -0,0 +1,35 @@
+package deepseek
+
+import "context"
+
+type tagsKey struct{}
+
+// WithTags returns a context carrying the given tags in addition to the tags already in ctx.
+//
+// Tags identify the caller of a request, e.g. a tenant or a team, and are used to attribute usage and enforce quotas.
+func WithTags(ctx context.Context, tags ...string) context.Context {
+	existing := TagsFromContext(ctx)
+	merged := make([]string, 0, len(existing)+len(tags))
+	merged = append(merged, existing...)
+	for _, tag := range tags {
+		if !containsTag(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return context.WithValue(ctx, tagsKey{}, merged)
+}
+
+// TagsFromContext returns the tags carried by ctx.
+func TagsFromContext(ctx context.Context) []string {
+	tags, _ := ctx.Value(tagsKey{}).([]string)
+	return tags
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,129 @@
 package deepseek
 
 import (
+	"io"
 	"math"
+	"os"
+	"sync"
 	"unicode"
+
+	"github.com/roushou/deepseek/internal/tokenizer"
+)
+
+// Tokens added by the DeepSeek chat template around the messages, see the chat_template of the published tokenizer_config.json.
+const (
+	// <｜begin▁of▁sentence｜>
+	beginOfSentenceTokens = 1
+	// <｜User｜>
+	userTurnTokens = 1
+	// <｜Assistant｜>
+	assistantTurnTokens = 1
+	// <｜end▁of▁sentence｜> closing an assistant turn, except for an assistant prefix left open for the model to continue.
+	endOfSentenceTokens = 1
+	// <｜tool▁outputs▁begin｜><｜tool▁output▁begin｜> ... <｜tool▁output▁end｜><｜tool▁outputs▁end｜>
+	toolOutputTokens = 4
+	// <｜Assistant｜> appended to prompt the model for its answer.
+	generationPromptTokens = 1
 )
 
+var tokenizers = struct {
+	sync.RWMutex
+	byModel  map[ModelID]*tokenizer.Tokenizer
+	fallback *tokenizer.Tokenizer
+}{byModel: map[ModelID]*tokenizer.Tokenizer{}}
+
+// LoadTokenizer loads a BPE vocabulary from a HuggingFace tokenizer.json file, e.g. for a self-hosted model.
+//
+// The tokenizer is used by CountTokens for the given models, or for every model when none is given, instead of the
+// embedded DeepSeek-V3 vocabulary.
+func LoadTokenizer(r io.Reader, models ...ModelID) error {
+	tok, err := tokenizer.Load(r)
+	if err != nil {
+		return err
+	}
+
+	tokenizers.Lock()
+	defer tokenizers.Unlock()
+	if len(models) == 0 {
+		tokenizers.fallback = tok
+	}
+	for _, model := range models {
+		tokenizers.byModel[model] = tok
+	}
+	return nil
+}
+
+// LoadTokenizerFile loads a tokenizer.json file from disk, see LoadTokenizer.
+func LoadTokenizerFile(path string, models ...ModelID) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return LoadTokenizer(f, models...)
+}
+
+// embeddedTokenizer returns the tokenizer of the embedded vocabulary, replaced by tests.
+var embeddedTokenizer = tokenizer.Default
+
+// lookupTokenizer returns the tokenizer of a model: the one loaded for it, else the one loaded for every model, else the
+// embedded one. It returns nil when no vocabulary is available.
+func lookupTokenizer(model ModelID) *tokenizer.Tokenizer {
+	tokenizers.RLock()
+	tok, ok := tokenizers.byModel[model]
+	if !ok {
+		tok = tokenizers.fallback
+	}
+	tokenizers.RUnlock()
+	if tok != nil {
+		return tok
+	}
+
+	tok, err := embeddedTokenizer()
+	if err != nil {
+		return nil
+	}
+	return tok
+}
+
+// CountTokens counts the tokens of text for the given model.
+//
+// It uses the vocabulary loaded with LoadTokenizer or the embedded DeepSeek-V3 vocabulary, decoded on first use. When
+// the embedded vocabulary wasn't generated (see internal/tokenizer/vocab), it falls back to the character based
+// estimation documented at https://api-docs.deepseek.com/quick_start/token_usage.
+func CountTokens(model ModelID, text string) int64 {
+	if tok := lookupTokenizer(model); tok != nil {
+		return int64(tok.Count(text))
+	}
+	return estimateTokens(text)
+}
+
+// CountMessageTokens counts the prompt tokens of the messages of a completion request, including the tokens added by the chat template.
+func CountMessageTokens(args CompletionArgs) int64 {
+	tokens := int64(beginOfSentenceTokens)
+	last := len(args.Messages) - 1
+	for i, message := range args.Messages {
+		tokens += CountTokens(args.Model, message.Content)
+		switch message.Role {
+		case UserRole:
+			tokens += userTurnTokens
+		case AssistantRole:
+			tokens += assistantTurnTokens
+			if i < last {
+				tokens += endOfSentenceTokens
+			}
+		case ToolRole:
+			tokens += toolOutputTokens
+		}
+	}
+
+	// The model is prompted for an answer unless the last message is an assistant prefix to continue.
+	if last < 0 || args.Messages[last].Role != AssistantRole {
+		tokens += generationPromptTokens
+	}
+	return tokens
+}
+
 // estimateTokens estimates the tokens for a given string according to the documentation https://api-docs.deepseek.com/quick_start/token_usage
 func estimateTokens(text string) int64 {
 	var tokens float64
@@ -2,7 +2,10 @@ package deepseek
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/roushou/deepseek/internal/tokenizer"
 )
 
 func TestEstimateTokens(t *testing.T) {
@@ -62,3 +65,122 @@ func TestEstimateTokens(t *testing.T) {
 	fmt.Println("wow")
 	fmt.Println(estimateTokens(input))
 }
+
+// testTokenizer is a minimal byte-level vocabulary that knows a handful of English merges.
+const testTokenizer = `{
+	"model": {
+		"type": "BPE",
+		"vocab": {"H": 0, "e": 1, "l": 2, "o": 3, "Ġ": 4, "W": 5, "r": 6, "d": 7, "ll": 8, "llo": 9, "Hello": 10, "ĠW": 11, "or": 12, "ĠWor": 13, "ĠWorld": 14, "He": 15, "ld": 16},
+		"merges": ["l l", "ll o", "H e", "He llo", "Ġ W", "o r", "ĠW or", "l d", "ĠWor ld"]
+	}
+}`
+
+// withoutEmbeddedTokenizer makes CountTokens estimate the tokens when no vocabulary is loaded, whether the embedded
+// vocabulary was generated or not.
+func withoutEmbeddedTokenizer(t testing.TB) {
+	t.Helper()
+	embedded := embeddedTokenizer
+	embeddedTokenizer = func() (*tokenizer.Tokenizer, error) { return nil, tokenizer.ErrNoVocabulary }
+	t.Cleanup(func() { embeddedTokenizer = embedded })
+}
+
+func withTestTokenizer(t testing.TB) {
+	t.Helper()
+	if err := LoadTokenizer(strings.NewReader(testTokenizer)); err != nil {
+		t.Fatalf("LoadTokenizer() error = %v", err)
+	}
+	t.Cleanup(func() {
+		tokenizers.Lock()
+		tokenizers.fallback = nil
+		tokenizers.Unlock()
+	})
+}
+
+func TestCountTokens(t *testing.T) {
+	withoutEmbeddedTokenizer(t)
+	if got := CountTokens(DeepSeekChat, "Hello World"); got != 3 {
+		t.Errorf("CountTokens() without vocabulary = %d; want 3", got)
+	}
+
+	// The embedded vocabulary is used when none is loaded.
+	embedded, err := tokenizer.Load(strings.NewReader(testTokenizer))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	embeddedTokenizer = func() (*tokenizer.Tokenizer, error) { return embedded, nil }
+	if got := CountTokens(DeepSeekChat, "Hello World"); got != 2 {
+		t.Errorf("CountTokens() with embedded vocabulary = %d; want 2", got)
+	}
+
+	withTestTokenizer(t)
+	if got := CountTokens(DeepSeekChat, "Hello World"); got != 2 {
+		t.Errorf("CountTokens() with vocabulary = %d; want 2", got)
+	}
+}
+
+func TestCountMessageTokens(t *testing.T) {
+	withTestTokenizer(t)
+
+	tests := []struct {
+		name     string
+		messages []Message
+		expected int64
+	}{
+		{
+			name:     "No messages",
+			messages: nil,
+			expected: beginOfSentenceTokens + generationPromptTokens,
+		},
+		{
+			name: "System and user",
+			messages: []Message{
+				{Role: SystemRole, Content: "Hello"},
+				{Role: UserRole, Content: "Hello World"},
+			},
+			expected: beginOfSentenceTokens + 1 + userTurnTokens + 2 + generationPromptTokens,
+		},
+		{
+			name: "Assistant prefix",
+			messages: []Message{
+				{Role: UserRole, Content: "Hello"},
+				{Role: AssistantRole, Content: "Hello"},
+			},
+			expected: beginOfSentenceTokens + userTurnTokens + 1 + assistantTurnTokens + 1,
+		},
+		{
+			name: "Assistant turn",
+			messages: []Message{
+				{Role: UserRole, Content: "Hello"},
+				{Role: AssistantRole, Content: "Hello"},
+				{Role: UserRole, Content: "Hello"},
+			},
+			expected: beginOfSentenceTokens + 2*(userTurnTokens+1) + assistantTurnTokens + 1 + endOfSentenceTokens + generationPromptTokens,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CountMessageTokens(CompletionArgs{Model: DeepSeekChat, Messages: tt.messages})
+			if got != tt.expected {
+				t.Errorf("CountMessageTokens() = %d; want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func BenchmarkCountTokens(b *testing.B) {
+	text := strings.Repeat("Hello World, 你好世界! func main() { fmt.Println(42) }\n", 64)
+
+	b.Run("BPE", func(b *testing.B) {
+		withTestTokenizer(b)
+		for i := 0; i < b.N; i++ {
+			CountTokens(DeepSeekChat, text)
+		}
+	})
+
+	b.Run("Heuristic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			estimateTokens(text)
+		}
+	})
+}